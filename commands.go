@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/rafaelmartins/ledns/internal/letsencrypt"
+	"github.com/rafaelmartins/ledns/internal/settings"
+)
+
+type command struct {
+	name        string
+	help        string
+	needsClient bool
+	needsDNS    bool
+	flags       func(fs *flag.FlagSet)
+	run         func(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error
+}
+
+const defaultCommand = "renew"
+
+var (
+	deactivateConfirm bool
+	revokeReason      string
+	revokeCertKey     bool
+	revokeKeyFile     string
+	pruneDryRun       bool
+
+	commands = []*command{
+		{
+			name:        "renew",
+			help:        "request new certificates and renew existing ones, if needed (default)",
+			needsClient: true,
+			needsDNS:    true,
+			run:         cmdRenew,
+		},
+		{
+			name:        "account-key-rollover",
+			help:        "replace the account key with a newly generated one",
+			needsClient: true,
+			run:         cmdAccountKeyRollover,
+		},
+		{
+			name:        "account-deactivate",
+			help:        "permanently deactivate the account (requires -yes)",
+			needsClient: true,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&deactivateConfirm, "yes", false, "confirm account deactivation")
+			},
+			run: cmdAccountDeactivate,
+		},
+		{
+			name:        "revoke",
+			help:        "revoke the current certificates of a common name, or a certificate file",
+			needsClient: true,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&revokeReason, "reason", "unspecified", "RFC 5280 revocation reason, name or code")
+				fs.BoolVar(&revokeCertKey, "cert-key", false, "sign the revocation with the certificate private key instead of the account key")
+				fs.StringVar(&revokeKeyFile, "key", "", "certificate private key file (implies -cert-key)")
+			},
+			run: cmdRevoke,
+		},
+		{
+			name:        "rotate-key",
+			help:        "request new certificates with newly generated private keys for the given common names",
+			needsClient: true,
+			needsDNS:    true,
+			run:         cmdRotateKey,
+		},
+		{
+			name: "prune",
+			help: "remove old certificate versions, according to retention settings",
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&pruneDryRun, "dry-run", false, "only list files that would be removed")
+			},
+			run: cmdPrune,
+		},
+		{
+			name: "deploy",
+			help: "install current certificates to their deploy destinations",
+			run:  cmdDeploy,
+		},
+	}
+)
+
+func getCertificates(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, certs []*letsencrypt.Certificate, rotateKey bool) error {
+	badCerts := [][]string{}
+	newCerts := []*letsencrypt.Certificate{}
+	for _, cert := range certs {
+		if len(cert.Names) == 0 {
+			continue
+		}
+
+		var (
+			newCert bool
+			err     error
+		)
+		if rotateKey {
+			newCert, err = le.RotateKey(ctx, cert)
+		} else {
+			newCert, err = le.GetCertificate(ctx, cert, s.Force)
+		}
+		if err != nil {
+			log.Print("error: ", err)
+			badCerts = append(badCerts, cert.Names)
+		}
+
+		// certificates may be partially renewed, e.g. only one of the key
+		// types, and must be deployed anyway.
+		if newCert {
+			newCerts = append(newCerts, cert)
+			if err2 := le.Deploy(cert); err2 != nil {
+				log.Print("error: ", err2)
+				if err == nil {
+					badCerts = append(badCerts, cert.Names)
+				}
+			}
+			if err := le.Prune(cert, false); err != nil {
+				log.Print("error: ", err)
+			}
+		}
+	}
+
+	// per-certificate commands always run. the global per-certificate
+	// command only runs if no global run-once command is defined.
+	for _, cert := range newCerts {
+		cmd := cert.UpdateCommand
+		if len(cmd) == 0 && len(s.UpdateCommandOnce) == 0 {
+			cmd = s.UpdateCommand
+		}
+		if err := le.RunCommand(cert, cmd); err != nil {
+			return err
+		}
+	}
+	if len(newCerts) > 0 {
+		if err := le.RunCommandOnce(s.UpdateCommandOnce); err != nil {
+			return err
+		}
+	}
+
+	if len(badCerts) > 0 {
+		return fmt.Errorf("failed to get certificate(s): %q", badCerts)
+	}
+	return nil
+}
+
+func cmdRenew(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	log.Printf("certificates:")
+	if len(s.Certificates) > 0 {
+		for _, cert := range s.Certificates {
+			if cert.DualKeyType != "" {
+				log.Printf("    %q (%s + %s)", cert.Names, cert.KeyType, cert.DualKeyType)
+			} else {
+				log.Printf("    %q (%s)", cert.Names, cert.KeyType)
+			}
+		}
+	} else {
+		log.Printf("    no certificates defined. exiting ...")
+		return nil
+	}
+
+	return getCertificates(ctx, s, le, s.Certificates, false)
+}
+
+func filterCertificates(s *settings.Settings, commonNames []string) ([]*letsencrypt.Certificate, error) {
+	if len(commonNames) == 0 {
+		return s.Certificates, nil
+	}
+
+	rv := []*letsencrypt.Certificate{}
+	for _, commonName := range commonNames {
+		found := false
+		for _, cert := range s.Certificates {
+			if len(cert.Names) > 0 && cert.Names[0] == commonName {
+				rv = append(rv, cert)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("certificate not defined: %s", commonName)
+		}
+	}
+	return rv, nil
+}
+
+func cmdRotateKey(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	if len(args) == 0 {
+		return errors.New("rotate-key requires at least one common name")
+	}
+
+	certs, err := filterCertificates(s, args)
+	if err != nil {
+		return err
+	}
+
+	return getCertificates(ctx, s, le, certs, true)
+}
+
+func cmdPrune(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	certs, err := filterCertificates(s, args)
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		if cert.KeepVersions == 0 && cert.KeepDays == 0 {
+			log.Printf("[%s] no retention policy defined, skipping ...", cert.Names[0])
+			continue
+		}
+		if err := le.Prune(cert, pruneDryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdAccountKeyRollover(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	return le.RolloverAccountKey(ctx)
+}
+
+func cmdAccountDeactivate(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	if !deactivateConfirm {
+		return errors.New("account deactivation is permanent, please confirm with -yes")
+	}
+	return le.DeactivateAccount(ctx)
+}
+
+func cmdRevoke(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	if len(args) != 1 {
+		return errors.New("revoke requires exactly one common name or certificate file")
+	}
+	return le.RevokeCertificate(ctx, args[0], revokeReason, revokeCertKey, revokeKeyFile)
+}
+
+func cmdDeploy(ctx context.Context, s *settings.Settings, le *letsencrypt.LetsEncrypt, args []string) error {
+	certs, err := filterCertificates(s, args)
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		if len(cert.Deploy) == 0 {
+			continue
+		}
+		if !le.IsIssued(cert) {
+			log.Printf("[%s] certificate not issued yet, skipping ...", cert.Names[0])
+			continue
+		}
+		if err := le.Deploy(cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
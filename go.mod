@@ -4,5 +4,8 @@ go 1.15
 
 require (
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
-	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
+	github.com/miekg/dns v1.1.50
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.2.0
 )
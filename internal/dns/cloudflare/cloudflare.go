@@ -0,0 +1,243 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://api.cloudflare.com"
+)
+
+type Cloudflare struct {
+	apiToken string
+	apiUrl   string
+}
+
+type response struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo *struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+type record struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// apiUrl is optional, and defaults to the public api
+func NewCloudflare(apiUrl string, apiToken string) (*Cloudflare, error) {
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	rv := &Cloudflare{
+		apiToken: apiToken,
+		apiUrl:   strings.TrimSuffix(apiUrl, "/"),
+	}
+
+	// just check if authentication works
+	if _, err := rv.request(context.Background(), http.MethodGet, "/client/v4/zones", map[string]string{
+		"per_page": "5",
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *Cloudflare) request(ctx context.Context, method string, endpoint string, args map[string]string, data map[string]interface{}) (*response, error) {
+	purl, err := url.ParseRequestURI(c.apiUrl + endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	pargs := url.Values{}
+	for k, v := range args {
+		pargs.Set(k, v)
+	}
+	purl.RawQuery = pargs.Encode()
+
+	var rbody io.Reader
+	if data != nil {
+		a, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		rbody = bytes.NewBuffer(a)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return nil, err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	req.Header.Add("Authorization", "Bearer "+c.apiToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &response{}
+	if err := json.Unmarshal(body, r); err != nil {
+		return nil, fmt.Errorf("cloudflare: request failed (%d): %s", resp.StatusCode, body)
+	}
+	if !r.Success || resp.StatusCode != http.StatusOK {
+		msgs := []string{}
+		for _, e := range r.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+		}
+		return nil, fmt.Errorf("cloudflare: request failed (%d): %s", resp.StatusCode, strings.Join(msgs, ", "))
+	}
+
+	return r, nil
+}
+
+func (c *Cloudflare) list(ctx context.Context, endpoint string, args map[string]string, f func(result json.RawMessage) error) error {
+	for page := 1; ; page++ {
+		pargs := map[string]string{
+			"page":     strconv.Itoa(page),
+			"per_page": "50",
+		}
+		for k, v := range args {
+			pargs[k] = v
+		}
+
+		r, err := c.request(ctx, http.MethodGet, endpoint, pargs, nil)
+		if err != nil {
+			return err
+		}
+		if err := f(r.Result); err != nil {
+			return err
+		}
+
+		if r.ResultInfo == nil || r.ResultInfo.Page >= r.ResultInfo.TotalPages {
+			return nil
+		}
+	}
+}
+
+func (c *Cloudflare) getZoneID(ctx context.Context, domain string) (string, error) {
+	rv := ""
+	if err := c.list(ctx, "/client/v4/zones", map[string]string{
+		"name": domain,
+	}, func(result json.RawMessage) error {
+		zones := []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(result, &zones); err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			if zone.Name != domain {
+				continue
+			}
+			if rv != "" {
+				return fmt.Errorf("cloudflare: more than one zone found: %s", domain)
+			}
+			rv = zone.ID
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if rv == "" {
+		return "", fmt.Errorf("cloudflare: zone not found: %s", domain)
+	}
+	return rv, nil
+}
+
+func (c *Cloudflare) getRecords(ctx context.Context, zid string, name string) ([]*record, error) {
+	rv := []*record{}
+	if err := c.list(ctx, "/client/v4/zones/"+zid+"/dns_records", map[string]string{
+		"type": "TXT",
+		"name": name,
+	}, func(result json.RawMessage) error {
+		records := []*record{}
+		if err := json.Unmarshal(result, &records); err != nil {
+			return err
+		}
+		rv = append(rv, records...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (c *Cloudflare) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	zid, err := c.getZoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.request(ctx, http.MethodPost, "/client/v4/zones/"+zid+"/dns_records", nil, map[string]interface{}{
+		"type":    "TXT",
+		"name":    host + "." + domain,
+		"content": value,
+		"ttl":     120,
+	})
+	return err
+}
+
+func (c *Cloudflare) RemoveTXTRecord(domain string, host string, value string) error {
+	ctx := context.Background()
+
+	zid, err := c.getZoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	records, err := c.getRecords(ctx, zid, host+"."+domain)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		// txt contents may be returned quoted
+		if rec.Type != "TXT" || strings.Trim(rec.Content, "\"") != value {
+			continue
+		}
+
+		if _, err := c.request(ctx, http.MethodDelete, "/client/v4/zones/"+zid+"/dns_records/"+rec.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cloudflare) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
@@ -0,0 +1,175 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret-token"
+
+// fakeZone holds the records of example.com, and the changes requested
+type fakeZone struct {
+	records []map[string]interface{}
+	created []map[string]interface{}
+	deleted []string
+}
+
+func writeResponse(w http.ResponseWriter, status int, result interface{}, page int, totalPages int) {
+	w.WriteHeader(status)
+	r := map[string]interface{}{
+		"success": status == http.StatusOK,
+		"errors":  []interface{}{},
+		"result":  result,
+	}
+	if status != http.StatusOK {
+		r["errors"] = []interface{}{map[string]interface{}{"code": 10000, "message": "Authentication error"}}
+	}
+	if totalPages > 0 {
+		r["result_info"] = map[string]interface{}{"page": page, "total_pages": totalPages}
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+// paginate splits items in pages of 2 items, to exercise pagination
+// regardless of the page size requested.
+func paginate(w http.ResponseWriter, r *http.Request, items []map[string]interface{}) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	total := (len(items) + 1) / 2
+	if total == 0 {
+		total = 1
+	}
+	rv := []map[string]interface{}{}
+	for i := (page - 1) * 2; i < len(items) && i < page*2; i++ {
+		rv = append(rv, items[i])
+	}
+	writeResponse(w, http.StatusOK, rv, page, total)
+}
+
+// the name filter of zones is ignored, so lookups must pick the exact zone,
+// that is only found in the second page
+var testZones = []map[string]interface{}{
+	{"id": "zone0", "name": "foo.example.com"},
+	{"id": "zone1", "name": "bar.example.com"},
+	{"id": "zone2", "name": "example.com"},
+}
+
+func newFakeZone(t *testing.T, z *fakeZone) *httptest.Server {
+	const prefix = "/client/v4/zones/zone2/dns_records"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			writeResponse(w, http.StatusForbidden, nil, 0, 0)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/client/v4/zones":
+			paginate(w, r, testZones)
+
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			if r.URL.Query().Get("type") != "TXT" || r.URL.Query().Get("name") != "_acme-challenge.example.com" {
+				t.Errorf("unexpected record filters: %s", r.URL.RawQuery)
+			}
+			paginate(w, r, z.records)
+
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			data := map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				t.Error(err)
+			}
+			z.created = append(z.created, data)
+			writeResponse(w, http.StatusOK, data, 0, 0)
+
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, prefix+"/"):
+			id := strings.TrimPrefix(r.URL.Path, prefix+"/")
+			z.deleted = append(z.deleted, id)
+			writeResponse(w, http.StatusOK, map[string]string{"id": id}, 0, 0)
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			writeResponse(w, http.StatusNotFound, nil, 0, 0)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newFakeZone(t, &fakeZone{})
+
+	if _, err := NewCloudflare(ts.URL, "bad-token"); err == nil {
+		t.Error("bad token accepted")
+	}
+	if _, err := NewCloudflare(ts.URL, testToken); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddTXTRecord(t *testing.T) {
+	z := &fakeZone{}
+	ts := newFakeZone(t, z)
+
+	c, err := NewCloudflare(ts.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]interface{}{
+		{"type": "TXT", "name": "_acme-challenge.example.com", "content": "foo", "ttl": float64(120)},
+	}
+	if !reflect.DeepEqual(z.created, expected) {
+		t.Errorf("unexpected records created: %v", z.created)
+	}
+}
+
+func TestRemoveTXTRecord(t *testing.T) {
+	z := &fakeZone{}
+	z.records = []map[string]interface{}{
+		{"id": "rec0", "type": "TXT", "name": "_acme-challenge.example.com", "content": "bar"},
+		{"id": "rec1", "type": "TXT", "name": "_acme-challenge.example.com", "content": "foobar"},
+		{"id": "rec2", "type": "TXT", "name": "_acme-challenge.example.com", "content": "baz"},
+		{"id": "rec3", "type": "TXT", "name": "_acme-challenge.example.com", "content": "\"foo\""},
+		{"id": "rec4", "type": "TXT", "name": "_acme-challenge.example.com", "content": "qux"},
+	}
+	ts := newFakeZone(t, z)
+
+	c, err := NewCloudflare(ts.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the matching record is in the second page
+	if !reflect.DeepEqual(z.deleted, []string{"rec3"}) {
+		t.Errorf("unexpected records deleted: %q", z.deleted)
+	}
+}
+
+func TestZoneNotFound(t *testing.T) {
+	ts := newFakeZone(t, &fakeZone{})
+
+	c, err := NewCloudflare(ts.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.org", "_acme-challenge", "foo"); err == nil {
+		t.Error("record added to unknown zone")
+	}
+}
@@ -0,0 +1,203 @@
+package desec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://desec.io"
+)
+
+type DeSEC struct {
+	apiToken string
+	apiUrl   string
+	mtx      sync.Mutex
+}
+
+type rrset struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Records []string `json:"records"`
+}
+
+// apiUrl is optional, and defaults to the public api
+func NewDeSEC(apiUrl string, apiToken string) (*DeSEC, error) {
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	rv := &DeSEC{
+		apiToken: apiToken,
+		apiUrl:   apiUrl,
+	}
+
+	// just check if authentication works
+	if _, err := rv.request(context.Background(), http.MethodGet, "/api/v1/domains/", nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *DeSEC) request(ctx context.Context, method string, endpoint string, data interface{}, v interface{}) (int, error) {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return 0, err
+	}
+	purl.Path = endpoint
+
+	var body []byte
+	if data != nil {
+		body, err = json.Marshal(data)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// desec throttles write requests aggressively, retry a few times
+	for i := 0; ; i++ {
+		var rbody io.Reader
+		if body != nil {
+			rbody = bytes.NewBuffer(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+		if err != nil {
+			return 0, err
+		}
+
+		if data != nil {
+			req.Header.Add("Content-Type", "application/json")
+		}
+
+		req.Header.Add("Authorization", "Token "+c.apiToken)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		rbytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && i < 5 {
+			wait, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if err != nil || wait <= 0 || wait > 60 {
+				wait = 1
+			}
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(time.Duration(wait) * time.Second):
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+			if resp.StatusCode == http.StatusNotFound {
+				return resp.StatusCode, nil
+			}
+			e := struct {
+				Detail string `json:"detail"`
+			}{}
+			if err := json.Unmarshal(rbytes, &e); err != nil || e.Detail == "" {
+				return resp.StatusCode, fmt.Errorf("desec: request failed (%d): %s", resp.StatusCode, rbytes)
+			}
+			return resp.StatusCode, fmt.Errorf("desec: request failed (%d): %s", resp.StatusCode, e.Detail)
+		}
+
+		if v != nil && len(rbytes) > 0 {
+			return resp.StatusCode, json.Unmarshal(rbytes, v)
+		}
+		return resp.StatusCode, nil
+	}
+}
+
+func (c *DeSEC) update(ctx context.Context, domain string, host string, value string, remove bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	endpoint := "/api/v1/domains/" + domain + "/rrsets/" + host + "/TXT/"
+	quoted := strconv.Quote(value)
+
+	current := &rrset{}
+	status, err := c.request(ctx, http.MethodGet, endpoint, nil, current)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		if remove {
+			return nil
+		}
+		// desec default minimum ttl
+		current = &rrset{TTL: 3600}
+	}
+
+	// desec has no per-record endpoints, the rrset is always written with
+	// its full list of records.
+	r := &rrset{
+		Subname: host,
+		Type:    "TXT",
+		TTL:     current.TTL,
+		Records: []string{},
+	}
+	found := false
+	for _, rec := range current.Records {
+		if rec == quoted {
+			found = true
+			if remove {
+				continue
+			}
+		}
+		r.Records = append(r.Records, rec)
+	}
+
+	if remove {
+		if !found {
+			return nil
+		}
+	} else {
+		if found {
+			return nil
+		}
+		r.Records = append(r.Records, quoted)
+	}
+
+	// bulk requests create missing rrsets, and an empty record list deletes
+	// the rrset
+	status, err = c.request(ctx, http.MethodPatch, "/api/v1/domains/"+domain+"/rrsets/", []*rrset{r}, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return fmt.Errorf("desec: zone not found: %s", domain)
+	}
+	return nil
+}
+
+func (c *DeSEC) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	return c.update(ctx, domain, host, value, false)
+}
+
+func (c *DeSEC) RemoveTXTRecord(domain string, host string, value string) error {
+	return c.update(context.Background(), domain, host, value, true)
+}
+
+func (c *DeSEC) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
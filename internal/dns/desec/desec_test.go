@@ -0,0 +1,122 @@
+package desec
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testToken = "secret"
+
+// newFakeDomain serves a single domain, example.com
+func newFakeDomain(t *testing.T, rrsets map[string]*rrset) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"detail": "Invalid token."})
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/domains/":
+			json.NewEncoder(w).Encode([]map[string]string{{"name": "example.com"}})
+
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/domains/example.com/rrsets/_acme-challenge/TXT/":
+			rr, found := rrsets["_acme-challenge"]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"detail": "Not found."})
+				return
+			}
+			json.NewEncoder(w).Encode(rr)
+
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/domains/example.com/rrsets/":
+			v := []*rrset{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Error(err)
+				return
+			}
+			for _, rr := range v {
+				if rr.Type != "TXT" {
+					t.Errorf("unexpected type: %s", rr.Type)
+				}
+				if len(rr.Records) == 0 {
+					delete(rrsets, rr.Subname)
+				} else {
+					rrsets[rr.Subname] = rr
+				}
+			}
+			json.NewEncoder(w).Encode(v)
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"detail": "Not found."})
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// the challenges for example.com and *.example.com share the same name
+func TestAddRemoveTXTRecord(t *testing.T) {
+	rrsets := map[string]*rrset{
+		"_acme-challenge.www": {
+			Subname: "_acme-challenge.www",
+			Type:    "TXT",
+			TTL:     3600,
+			Records: []string{`"other"`},
+		},
+	}
+	ts := newFakeDomain(t, rrsets)
+
+	c, err := NewDeSEC(ts.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		remove   bool
+		value    string
+		expected []string
+	}{
+		{false, "foo", []string{`"foo"`}},
+		{false, "bar", []string{`"foo"`, `"bar"`}},
+		{false, "bar", []string{`"foo"`, `"bar"`}},
+		{true, "foo", []string{`"bar"`}},
+		{true, "foo", []string{`"bar"`}},
+		{true, "bar", nil},
+	} {
+		if step.remove {
+			err = c.RemoveTXTRecord("example.com", "_acme-challenge", step.value)
+		} else {
+			err = c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", step.value)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var records []string
+		if rr, found := rrsets["_acme-challenge"]; found {
+			records = rr.Records
+		}
+		if !reflect.DeepEqual(records, step.expected) {
+			t.Fatalf("remove=%t %s: unexpected records: %q", step.remove, step.value, records)
+		}
+	}
+
+	if rr := rrsets["_acme-challenge.www"]; rr == nil || !reflect.DeepEqual(rr.Records, []string{`"other"`}) {
+		t.Errorf("unrelated rrset changed: %v", rr)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newFakeDomain(t, nil)
+
+	if _, err := NewDeSEC(ts.URL, "bad-token"); err == nil {
+		t.Error("bad token accepted")
+	}
+}
@@ -0,0 +1,161 @@
+package digitalocean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://api.digitalocean.com"
+)
+
+type DigitalOcean struct {
+	apiToken string
+	apiUrl   string
+}
+
+// apiUrl is optional, and defaults to the public api
+func NewDigitalOcean(apiUrl string, apiToken string) (*DigitalOcean, error) {
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	rv := &DigitalOcean{
+		apiToken: apiToken,
+		apiUrl:   apiUrl,
+	}
+
+	// just check if authentication works
+	if err := rv.request(context.Background(), http.MethodGet, "/v2/account", nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *DigitalOcean) request(ctx context.Context, method string, endpoint string, args map[string]string, data map[string]interface{}, v interface{}) error {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return err
+	}
+	purl.Path = endpoint
+
+	pargs := url.Values{}
+	for k, v := range args {
+		pargs.Set(k, v)
+	}
+	purl.RawQuery = pargs.Encode()
+
+	var rbody io.Reader
+	if data != nil {
+		a, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		rbody = bytes.NewBuffer(a)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	req.Header.Add("Authorization", "Bearer "+c.apiToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		e := struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		}{}
+		if err := json.Unmarshal(body, &e); err != nil {
+			return fmt.Errorf("digitalocean: request failed (%d): %s", resp.StatusCode, body)
+		}
+		return fmt.Errorf("digitalocean: request failed (%d): %s: %s", resp.StatusCode, e.ID, e.Message)
+	}
+
+	if v != nil {
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+func (c *DigitalOcean) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	return c.request(ctx, http.MethodPost, "/v2/domains/"+domain+"/records", nil, map[string]interface{}{
+		"type": "TXT",
+		"name": host,
+		"data": value,
+		"ttl":  60,
+	}, nil)
+}
+
+func (c *DigitalOcean) RemoveTXTRecord(domain string, host string, value string) error {
+	ids := []int{}
+	for page := 1; ; page++ {
+		v := struct {
+			DomainRecords []struct {
+				ID   int    `json:"id"`
+				Type string `json:"type"`
+				Name string `json:"name"`
+				Data string `json:"data"`
+			} `json:"domain_records"`
+			Links struct {
+				Pages struct {
+					Next string `json:"next"`
+				} `json:"pages"`
+			} `json:"links"`
+		}{}
+		if err := c.request(context.Background(), http.MethodGet, "/v2/domains/"+domain+"/records", map[string]string{
+			"type":     "TXT",
+			"name":     host + "." + domain,
+			"page":     strconv.Itoa(page),
+			"per_page": "200",
+		}, nil, &v); err != nil {
+			return err
+		}
+
+		for _, rec := range v.DomainRecords {
+			if rec.Name == host && rec.Type == "TXT" && rec.Data == value {
+				ids = append(ids, rec.ID)
+			}
+		}
+
+		if v.Links.Pages.Next == "" {
+			break
+		}
+	}
+
+	for _, id := range ids {
+		if err := c.request(context.Background(), http.MethodDelete, "/v2/domains/"+domain+"/records/"+strconv.Itoa(id), nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *DigitalOcean) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
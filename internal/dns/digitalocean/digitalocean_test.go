@@ -0,0 +1,113 @@
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret"
+
+type testRecord struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+func TestAddRemoveTXTRecord(t *testing.T) {
+	records := []*testRecord{
+		{1, "TXT", "_acme-challenge", "bar", 60},
+		{2, "TXT", "_acme-challenge.www", "foo", 60},
+		{3, "CNAME", "_acme-challenge", "foo", 60},
+	}
+	deleted := []int{}
+
+	const prefix = "/v2/domains/example.com/records"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"id": "unauthorized", "message": "Unable to authenticate you"})
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/account":
+			json.NewEncoder(w).Encode(map[string]interface{}{"account": map[string]string{"status": "active"}})
+
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			rec := &testRecord{}
+			if err := json.NewDecoder(r.Body).Decode(rec); err != nil {
+				t.Error(err)
+				return
+			}
+			rec.ID = len(records) + 1
+			records = append(records, rec)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"domain_record": rec})
+
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			// filters are ignored, and pages have 2 records
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			v := map[string]interface{}{
+				"domain_records": []*testRecord{},
+				"links":          map[string]interface{}{},
+			}
+			for i := (page - 1) * 2; i < len(records) && i < page*2; i++ {
+				v["domain_records"] = append(v["domain_records"].([]*testRecord), records[i])
+			}
+			if page*2 < len(records) {
+				v["links"] = map[string]interface{}{"pages": map[string]string{"next": "next"}}
+			}
+			json.NewEncoder(w).Encode(v)
+
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, prefix+"/"):
+			id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix+"/"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			deleted = append(deleted, id)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"id": "not_found", "message": "not found"})
+		}
+	}))
+	defer ts.Close()
+
+	if _, err := NewDigitalOcean(ts.URL, "bad-token"); err == nil {
+		t.Error("bad token accepted")
+	}
+
+	c, err := NewDigitalOcean(ts.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "baz"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := records[3]; rec.Type != "TXT" || rec.Name != "_acme-challenge" || rec.Data != "foo" {
+		t.Errorf("unexpected record created: %+v", rec)
+	}
+
+	// the record is only found in the second page
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []int{4}) {
+		t.Errorf("unexpected records deleted: %v", deleted)
+	}
+}
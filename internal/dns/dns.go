@@ -7,6 +7,9 @@ import (
 	"github.com/rafaelmartins/ledns/internal/dns/utils"
 )
 
+// implementations must only add or remove the given value. the challenges for
+// example.com and *.example.com share the same name, and are deployed at the
+// same time.
 type DNS interface {
 	AddTXTRecord(ctx context.Context, domain string, host string, value string) error
 	CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error)
@@ -0,0 +1,112 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+type Exec struct {
+	addCommand    []string
+	checkCommand  []string
+	removeCommand []string
+	timeout       time.Duration
+}
+
+// the check command is optional, and must exit with 0 if the record is
+// published, 1 if not yet and any other code on errors. if not defined the
+// authoritative name servers are queried.
+func NewExec(addCommand []string, checkCommand []string, removeCommand []string, timeout time.Duration) (*Exec, error) {
+	if len(addCommand) == 0 {
+		return nil, fmt.Errorf("exec: add command not defined")
+	}
+	if len(removeCommand) == 0 {
+		return nil, fmt.Errorf("exec: remove command not defined")
+	}
+
+	return &Exec{
+		addCommand:    addCommand,
+		checkCommand:  checkCommand,
+		removeCommand: removeCommand,
+		timeout:       timeout,
+	}, nil
+}
+
+func (c *Exec) run(ctx context.Context, action string, command []string, domain string, host string, value string) (int, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(
+		os.Environ(),
+		"LEDNS_DNS_ACTION="+action,
+		"LEDNS_DNS_DOMAIN="+domain,
+		"LEDNS_DNS_HOST="+host,
+		"LEDNS_DNS_FQDN="+host+"."+domain,
+		"LEDNS_DNS_VALUE="+value,
+	)
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return -1, fmt.Errorf("exec: %s command %q: %w", action, command, ctx.Err())
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("exec: %s command %q: %w", action, command, err)
+	}
+	return 0, nil
+}
+
+func (c *Exec) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	code, err := c.run(ctx, "add", c.addCommand, domain, host, value)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("exec: add command %q failed with exit code %d", c.addCommand, code)
+	}
+	return nil
+}
+
+func (c *Exec) RemoveTXTRecord(domain string, host string, value string) error {
+	code, err := c.run(context.Background(), "remove", c.removeCommand, domain, host, value)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("exec: remove command %q failed with exit code %d", c.removeCommand, code)
+	}
+	return nil
+}
+
+func (c *Exec) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	if len(c.checkCommand) == 0 {
+		return utils.CheckTXTFromNS(domain, host, value)
+	}
+
+	code, err := c.run(ctx, "check", c.checkCommand, domain, host, value)
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	}
+	return false, fmt.Errorf("exec: check command %q failed with exit code %d", c.checkCommand, code)
+}
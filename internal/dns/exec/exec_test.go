@@ -0,0 +1,123 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newScript creates a script that logs its environment and exits with the
+// code read from a file, returning the command and a function to set the
+// exit code.
+func newScript(t *testing.T, body string) ([]string, func(code string)) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.sh")
+	if err := ioutil.WriteFile(script, []byte(`#!/bin/sh
+echo "$LEDNS_DNS_ACTION $LEDNS_DNS_DOMAIN $LEDNS_DNS_HOST $LEDNS_DNS_FQDN $LEDNS_DNS_VALUE" >> "`+filepath.Join(dir, "log")+`"
+`+body+`
+exit "$(cat "`+filepath.Join(dir, "code")+`")"
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	setCode := func(code string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "code"), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setCode("0")
+	return []string{"/bin/sh", script}, setCode
+}
+
+func TestExitCodes(t *testing.T) {
+	cmd, setCode := newScript(t, "")
+
+	c, err := NewExec(cmd, cmd, cmd, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		code  string
+		add   bool
+		check bool
+		err   bool
+	}{
+		{"0", true, true, false},
+		{"1", false, false, false},
+		{"2", false, false, true},
+	} {
+		setCode(tc.code)
+
+		if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); (err == nil) != tc.add {
+			t.Errorf("exit code %s: unexpected add result: %v", tc.code, err)
+		}
+		if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); (err == nil) != tc.add {
+			t.Errorf("exit code %s: unexpected remove result: %v", tc.code, err)
+		}
+
+		// 0 means the record is published, 1 not yet, others are errors
+		found, err := c.CheckTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo")
+		if (err != nil) != tc.err || found != tc.check {
+			t.Errorf("exit code %s: unexpected check result: %t, %v", tc.code, found, err)
+		}
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(filepath.Dir(cmd[1]), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("unexpected number of runs: %d", len(lines))
+	}
+	for i, action := range []string{"add", "remove", "check"} {
+		if expected := action + " example.com _acme-challenge _acme-challenge.example.com foo"; lines[i] != expected {
+			t.Errorf("unexpected environment: %q != %q", lines[i], expected)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cmd, _ := newScript(t, "exec sleep 60")
+
+	c, err := NewExec(cmd, cmd, cmd, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("command not killed after timeout: %s", d)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	cmd, _ := newScript(t, "exec sleep 60")
+
+	// no timeout, only the context stops the command
+	c, err := NewExec(cmd, cmd, cmd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = c.CheckTXTRecord(ctx, "example.com", "_acme-challenge", "foo")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("command not killed after cancel: %s", d)
+	}
+}
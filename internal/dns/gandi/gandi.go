@@ -0,0 +1,187 @@
+package gandi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://api.gandi.net"
+)
+
+type Gandi struct {
+	auth   string
+	apiUrl string
+	mtx    sync.Mutex
+}
+
+// personal access tokens replace the deprecated api keys, but both are
+// still accepted by livedns. apiUrl is optional, and defaults to the public
+// api.
+func NewGandi(apiUrl string, apiKey string, personalAccessToken string) (*Gandi, error) {
+	if apiKey != "" && personalAccessToken != "" {
+		return nil, fmt.Errorf("gandi: api key and personal access token are mutually exclusive")
+	}
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	rv := &Gandi{
+		apiUrl: apiUrl,
+	}
+	if personalAccessToken != "" {
+		rv.auth = "Bearer " + personalAccessToken
+	} else if apiKey != "" {
+		rv.auth = "Apikey " + apiKey
+	} else {
+		return nil, fmt.Errorf("gandi: api key or personal access token required")
+	}
+
+	// just check if authentication works
+	if _, err := rv.request(context.Background(), http.MethodGet, "/v5/livedns/domains", nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *Gandi) request(ctx context.Context, method string, endpoint string, data interface{}, v interface{}) (int, error) {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return 0, err
+	}
+	purl.Path = endpoint
+
+	var rbody io.Reader
+	if data != nil {
+		a, err := json.Marshal(data)
+		if err != nil {
+			return 0, err
+		}
+		rbody = bytes.NewBuffer(a)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return 0, err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	req.Header.Add("Authorization", c.auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		if resp.StatusCode == http.StatusNotFound {
+			return resp.StatusCode, nil
+		}
+		e := struct {
+			Message string `json:"message"`
+		}{}
+		if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+			return resp.StatusCode, fmt.Errorf("gandi: request failed (%d): %s", resp.StatusCode, body)
+		}
+		return resp.StatusCode, fmt.Errorf("gandi: request failed (%d): %s", resp.StatusCode, e.Message)
+	}
+
+	if v != nil && len(body) > 0 {
+		return resp.StatusCode, json.Unmarshal(body, v)
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Gandi) update(ctx context.Context, domain string, host string, value string, remove bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	endpoint := "/v5/livedns/domains/" + domain + "/records/" + host + "/TXT"
+
+	current := struct {
+		TTL    int      `json:"rrset_ttl"`
+		Values []string `json:"rrset_values"`
+	}{}
+	status, err := c.request(ctx, http.MethodGet, endpoint, nil, &current)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		if remove {
+			return nil
+		}
+		current.TTL = 300
+	}
+
+	// the PUT request sets rrset_values as a whole
+	values := []string{}
+	found := false
+	for _, v := range current.Values {
+		if strings.Trim(v, "\"") == value {
+			found = true
+			if remove {
+				continue
+			}
+		}
+		values = append(values, v)
+	}
+
+	if remove {
+		if !found {
+			return nil
+		}
+		if len(values) == 0 {
+			_, err := c.request(ctx, http.MethodDelete, endpoint, nil, nil)
+			return err
+		}
+	} else {
+		if found {
+			return nil
+		}
+		values = append(values, strconv.Quote(value))
+	}
+
+	status, err = c.request(ctx, http.MethodPut, endpoint, map[string]interface{}{
+		"rrset_ttl":    current.TTL,
+		"rrset_values": values,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return fmt.Errorf("gandi: zone not found: %s", domain)
+	}
+	return nil
+}
+
+func (c *Gandi) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	return c.update(ctx, domain, host, value, false)
+}
+
+func (c *Gandi) RemoveTXTRecord(domain string, host string, value string) error {
+	return c.update(context.Background(), domain, host, value, true)
+}
+
+func (c *Gandi) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
@@ -0,0 +1,126 @@
+package gandi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret"
+
+type testRRSet struct {
+	TTL    int      `json:"rrset_ttl"`
+	Values []string `json:"rrset_values"`
+}
+
+// newFakeDomain serves a single domain, example.com
+func newFakeDomain(t *testing.T, rrsets map[string]*testRRSet) *httptest.Server {
+	const prefix = "/v5/livedns/domains/example.com/records/"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Access was denied to this resource."})
+			return
+		}
+
+		if r.Method == http.MethodGet && r.URL.Path == "/v5/livedns/domains" {
+			json.NewEncoder(w).Encode([]map[string]string{{"fqdn": "example.com"}})
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Not found"})
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, prefix)
+
+		switch r.Method {
+		case http.MethodGet:
+			rr, found := rrsets[key]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"message": "Can't find the DNS record"})
+				return
+			}
+			json.NewEncoder(w).Encode(rr)
+		case http.MethodPut:
+			rr := &testRRSet{}
+			if err := json.NewDecoder(r.Body).Decode(rr); err != nil {
+				t.Error(err)
+				return
+			}
+			rrsets[key] = rr
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"message": "DNS Record Created"})
+		case http.MethodDelete:
+			delete(rrsets, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// the challenges for example.com and *.example.com share the same name
+func TestAddRemoveTXTRecord(t *testing.T) {
+	rrsets := map[string]*testRRSet{
+		"_acme-challenge.www/TXT": {TTL: 300, Values: []string{`"other"`}},
+	}
+	ts := newFakeDomain(t, rrsets)
+
+	c, err := NewGandi(ts.URL, "", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		remove   bool
+		value    string
+		expected []string
+	}{
+		{false, "foo", []string{`"foo"`}},
+		{false, "bar", []string{`"foo"`, `"bar"`}},
+		{false, "bar", []string{`"foo"`, `"bar"`}},
+		{true, "foo", []string{`"bar"`}},
+		{true, "foo", []string{`"bar"`}},
+		{true, "bar", nil},
+	} {
+		if step.remove {
+			err = c.RemoveTXTRecord("example.com", "_acme-challenge", step.value)
+		} else {
+			err = c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", step.value)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var values []string
+		if rr, found := rrsets["_acme-challenge/TXT"]; found {
+			values = rr.Values
+		}
+		if !reflect.DeepEqual(values, step.expected) {
+			t.Fatalf("remove=%t %s: unexpected values: %q", step.remove, step.value, values)
+		}
+	}
+
+	if rr := rrsets["_acme-challenge.www/TXT"]; rr == nil || !reflect.DeepEqual(rr.Values, []string{`"other"`}) {
+		t.Errorf("unrelated rrset changed: %v", rr)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newFakeDomain(t, nil)
+
+	if _, err := NewGandi(ts.URL, "", "bad-token"); err == nil {
+		t.Error("bad token accepted")
+	}
+}
@@ -0,0 +1,51 @@
+package dns
+
+import (
+	"context"
+	"sync"
+)
+
+// Lazy creates the provider when first used.
+type Lazy struct {
+	factory func() (DNS, error)
+	once    sync.Once
+	dns     DNS
+	err     error
+}
+
+func NewLazy(factory func() (DNS, error)) *Lazy {
+	return &Lazy{
+		factory: factory,
+	}
+}
+
+func (l *Lazy) get() (DNS, error) {
+	l.once.Do(func() {
+		l.dns, l.err = l.factory()
+	})
+	return l.dns, l.err
+}
+
+func (l *Lazy) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	p, err := l.get()
+	if err != nil {
+		return err
+	}
+	return p.AddTXTRecord(ctx, domain, host, value)
+}
+
+func (l *Lazy) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	p, err := l.get()
+	if err != nil {
+		return false, err
+	}
+	return p.CheckTXTRecord(ctx, domain, host, value)
+}
+
+func (l *Lazy) RemoveTXTRecord(domain string, host string, value string) error {
+	p, err := l.get()
+	if err != nil {
+		return err
+	}
+	return p.RemoveTXTRecord(domain, host, value)
+}
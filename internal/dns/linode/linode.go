@@ -0,0 +1,211 @@
+package linode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://api.linode.com"
+)
+
+type Linode struct {
+	apiToken string
+	apiUrl   string
+}
+
+// apiUrl is optional, and defaults to the public api
+func NewLinode(apiUrl string, apiToken string) (*Linode, error) {
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	rv := &Linode{
+		apiToken: apiToken,
+		apiUrl:   apiUrl,
+	}
+
+	// just check if authentication works
+	if err := rv.request(context.Background(), http.MethodGet, "/v4/profile", nil, nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *Linode) request(ctx context.Context, method string, endpoint string, args map[string]string, filter map[string]interface{}, data map[string]interface{}, v interface{}) error {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return err
+	}
+	purl.Path = endpoint
+
+	pargs := url.Values{}
+	for k, v := range args {
+		pargs.Set(k, v)
+	}
+	purl.RawQuery = pargs.Encode()
+
+	var rbody io.Reader
+	if data != nil {
+		a, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		rbody = bytes.NewBuffer(a)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	if filter != nil {
+		f, err := json.Marshal(filter)
+		if err != nil {
+			return err
+		}
+		req.Header.Add("X-Filter", string(f))
+	}
+
+	req.Header.Add("Authorization", "Bearer "+c.apiToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := struct {
+			Errors []struct {
+				Field  string `json:"field"`
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		}{}
+		if err := json.Unmarshal(body, &e); err != nil || len(e.Errors) == 0 {
+			return fmt.Errorf("linode: request failed (%d): %s", resp.StatusCode, body)
+		}
+		msgs := []string{}
+		for _, err := range e.Errors {
+			if err.Field != "" {
+				msgs = append(msgs, err.Field+": "+err.Reason)
+			} else {
+				msgs = append(msgs, err.Reason)
+			}
+		}
+		return fmt.Errorf("linode: request failed (%d): %s", resp.StatusCode, strings.Join(msgs, ", "))
+	}
+
+	if v != nil {
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+func (c *Linode) getZoneID(ctx context.Context, domain string) (int, error) {
+	v := struct {
+		Data []struct {
+			ID     int    `json:"id"`
+			Domain string `json:"domain"`
+		} `json:"data"`
+	}{}
+	if err := c.request(ctx, http.MethodGet, "/v4/domains", nil, map[string]interface{}{
+		"domain": domain,
+	}, nil, &v); err != nil {
+		return 0, err
+	}
+
+	if len(v.Data) == 0 {
+		return 0, fmt.Errorf("linode: zone not found: %s", domain)
+	}
+	if len(v.Data) > 1 {
+		return 0, fmt.Errorf("linode: more than one zone found: %s", domain)
+	}
+	if domain != v.Data[0].Domain {
+		return 0, fmt.Errorf("linode: returned zone does not match: %q != %q", domain, v.Data[0].Domain)
+	}
+
+	return v.Data[0].ID, nil
+}
+
+func (c *Linode) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	zid, err := c.getZoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return c.request(ctx, http.MethodPost, "/v4/domains/"+strconv.Itoa(zid)+"/records", nil, nil, map[string]interface{}{
+		"type":    "TXT",
+		"name":    host,
+		"target":  value,
+		"ttl_sec": 300,
+	}, nil)
+}
+
+func (c *Linode) RemoveTXTRecord(domain string, host string, value string) error {
+	zid, err := c.getZoneID(context.Background(), domain)
+	if err != nil {
+		return err
+	}
+
+	ids := []int{}
+	for page := 1; ; page++ {
+		v := struct {
+			Data []struct {
+				ID     int    `json:"id"`
+				Type   string `json:"type"`
+				Name   string `json:"name"`
+				Target string `json:"target"`
+			} `json:"data"`
+			Page  int `json:"page"`
+			Pages int `json:"pages"`
+		}{}
+		if err := c.request(context.Background(), http.MethodGet, "/v4/domains/"+strconv.Itoa(zid)+"/records", map[string]string{
+			"page":      strconv.Itoa(page),
+			"page_size": "500",
+		}, nil, nil, &v); err != nil {
+			return err
+		}
+
+		for _, rec := range v.Data {
+			if rec.Name == host && rec.Type == "TXT" && rec.Target == value {
+				ids = append(ids, rec.ID)
+			}
+		}
+
+		if v.Page >= v.Pages {
+			break
+		}
+	}
+
+	for _, id := range ids {
+		if err := c.request(context.Background(), http.MethodDelete, "/v4/domains/"+strconv.Itoa(zid)+"/records/"+strconv.Itoa(id), nil, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Linode) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
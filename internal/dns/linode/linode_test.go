@@ -0,0 +1,118 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret"
+
+type testRecord struct {
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTL    int    `json:"ttl_sec,omitempty"`
+}
+
+func TestAddRemoveTXTRecord(t *testing.T) {
+	records := []*testRecord{
+		{1, "TXT", "_acme-challenge", "bar", 300},
+		{2, "TXT", "_acme-challenge.www", "foo", 300},
+		{3, "CNAME", "_acme-challenge", "foo", 300},
+	}
+	deleted := []int{}
+
+	const prefix = "/v4/domains/10/records"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]string{{"reason": "Invalid Token"}}})
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v4/profile":
+			json.NewEncoder(w).Encode(map[string]string{"username": "test"})
+
+		case r.Method == http.MethodGet && r.URL.Path == "/v4/domains":
+			if f := r.Header.Get("X-Filter"); f != `{"domain":"example.com"}` {
+				t.Errorf("unexpected filter: %s", f)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": []map[string]interface{}{{"id": 10, "domain": "example.com"}},
+			})
+
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			rec := &testRecord{}
+			if err := json.NewDecoder(r.Body).Decode(rec); err != nil {
+				t.Error(err)
+				return
+			}
+			rec.ID = len(records) + 1
+			records = append(records, rec)
+			json.NewEncoder(w).Encode(rec)
+
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			// pages have 2 records
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			data := []*testRecord{}
+			for i := (page - 1) * 2; i < len(records) && i < page*2; i++ {
+				data = append(data, records[i])
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data":  data,
+				"page":  page,
+				"pages": (len(records) + 1) / 2,
+			})
+
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, prefix+"/"):
+			id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix+"/"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			deleted = append(deleted, id)
+			w.Write([]byte("{}"))
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]string{{"reason": "Not found"}}})
+		}
+	}))
+	defer ts.Close()
+
+	if _, err := NewLinode(ts.URL, "bad-token"); err == nil {
+		t.Error("bad token accepted")
+	}
+
+	c, err := NewLinode(ts.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "baz"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := records[3]; rec.Type != "TXT" || rec.Name != "_acme-challenge" || rec.Target != "foo" {
+		t.Errorf("unexpected record created: %+v", rec)
+	}
+
+	// the record is only found in the second page
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []int{4}) {
+		t.Errorf("unexpected records deleted: %v", deleted)
+	}
+}
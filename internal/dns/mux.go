@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Mux dispatches records to the provider hosting the zone. zones not mapped
+// to any provider, or their parent zones, use the fallback provider.
+type Mux struct {
+	zones    map[string]DNS
+	fallback DNS
+}
+
+func NewMux(zones map[string]DNS, fallback DNS) *Mux {
+	return &Mux{
+		zones:    zones,
+		fallback: fallback,
+	}
+}
+
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+func (m *Mux) get(domain string) (DNS, error) {
+	zone := normalizeZone(domain)
+	for {
+		if p, found := m.zones[zone]; found {
+			return p, nil
+		}
+		i := strings.Index(zone, ".")
+		if i < 0 {
+			break
+		}
+		zone = zone[i+1:]
+	}
+
+	if m.fallback == nil {
+		return nil, fmt.Errorf("dns: no provider defined for zone: %s", domain)
+	}
+	return m.fallback, nil
+}
+
+func (m *Mux) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	p, err := m.get(domain)
+	if err != nil {
+		return err
+	}
+	return p.AddTXTRecord(ctx, domain, host, value)
+}
+
+func (m *Mux) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	p, err := m.get(domain)
+	if err != nil {
+		return false, err
+	}
+	return p.CheckTXTRecord(ctx, domain, host, value)
+}
+
+func (m *Mux) RemoveTXTRecord(domain string, host string, value string) error {
+	p, err := m.get(domain)
+	if err != nil {
+		return err
+	}
+	return p.RemoveTXTRecord(domain, host, value)
+}
@@ -0,0 +1,235 @@
+package ovh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+var endpoints = map[string]string{
+	"ovh-eu":        "https://eu.api.ovh.com/1.0",
+	"ovh-ca":        "https://ca.api.ovh.com/1.0",
+	"ovh-us":        "https://api.us.ovhcloud.com/1.0",
+	"kimsufi-eu":    "https://eu.api.kimsufi.com/1.0",
+	"kimsufi-ca":    "https://ca.api.kimsufi.com/1.0",
+	"soyoustart-eu": "https://eu.api.soyoustart.com/1.0",
+	"soyoustart-ca": "https://ca.api.soyoustart.com/1.0",
+}
+
+type OVH struct {
+	apiUrl            string
+	applicationKey    string
+	applicationSecret string
+	consumerKey       string
+	timeDelta         time.Duration
+}
+
+// endpoint is either a known endpoint name, e.g. ovh-eu, or an api url
+func NewOVH(endpoint string, applicationKey string, applicationSecret string, consumerKey string) (*OVH, error) {
+	if endpoint == "" {
+		endpoint = "ovh-eu"
+	}
+	apiUrl, found := endpoints[endpoint]
+	if !found {
+		if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+			return nil, fmt.Errorf("ovh: invalid endpoint: %s", endpoint)
+		}
+		apiUrl = strings.TrimSuffix(endpoint, "/")
+	}
+
+	rv := &OVH{
+		apiUrl:            apiUrl,
+		applicationKey:    applicationKey,
+		applicationSecret: applicationSecret,
+		consumerKey:       consumerKey,
+	}
+
+	if err := rv.syncTime(context.Background()); err != nil {
+		return nil, err
+	}
+
+	// just check if authentication works
+	if err := rv.request(context.Background(), http.MethodGet, "/auth/currentCredential", nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+// signatures include a timestamp that must be close to the server time
+func (c *OVH) syncTime(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiUrl+"/auth/time", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ovh: failed to get server time (%d): %s", resp.StatusCode, body)
+	}
+
+	ts, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("ovh: invalid server time: %w", err)
+	}
+	c.timeDelta = time.Until(time.Unix(ts, 0))
+	return nil
+}
+
+func (c *OVH) sign(method string, purl string, body []byte, ts string) string {
+	h := sha1.Sum([]byte(strings.Join([]string{
+		c.applicationSecret,
+		c.consumerKey,
+		method,
+		purl,
+		string(body),
+		ts,
+	}, "+")))
+	return "$1$" + hex.EncodeToString(h[:])
+}
+
+func (c *OVH) request(ctx context.Context, method string, endpoint string, args map[string]string, data map[string]interface{}, v interface{}) error {
+	purl, err := url.ParseRequestURI(c.apiUrl + endpoint)
+	if err != nil {
+		return err
+	}
+
+	pargs := url.Values{}
+	for k, v := range args {
+		pargs.Set(k, v)
+	}
+	purl.RawQuery = pargs.Encode()
+
+	var (
+		body  []byte
+		rbody io.Reader
+	)
+	if data != nil {
+		body, err = json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		rbody = bytes.NewBuffer(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	ts := strconv.FormatInt(time.Now().Add(c.timeDelta).Unix(), 10)
+	req.Header.Add("X-Ovh-Application", c.applicationKey)
+	req.Header.Add("X-Ovh-Consumer", c.consumerKey)
+	req.Header.Add("X-Ovh-Timestamp", ts)
+	req.Header.Add("X-Ovh-Signature", c.sign(method, purl.String(), body, ts))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	rbytes, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := struct {
+			Message string `json:"message"`
+		}{}
+		if err := json.Unmarshal(rbytes, &e); err != nil || e.Message == "" {
+			return fmt.Errorf("ovh: request failed (%d): %s", resp.StatusCode, rbytes)
+		}
+		return fmt.Errorf("ovh: request failed (%d): %s", resp.StatusCode, e.Message)
+	}
+
+	if v != nil {
+		return json.Unmarshal(rbytes, v)
+	}
+	return nil
+}
+
+// changes are only published after the zone is refreshed
+func (c *OVH) refresh(ctx context.Context, domain string) error {
+	return c.request(ctx, http.MethodPost, "/domain/zone/"+domain+"/refresh", nil, nil, nil)
+}
+
+func (c *OVH) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	if err := c.request(ctx, http.MethodPost, "/domain/zone/"+domain+"/record", nil, map[string]interface{}{
+		"fieldType": "TXT",
+		"subDomain": host,
+		"target":    value,
+		"ttl":       60,
+	}, nil); err != nil {
+		return err
+	}
+
+	return c.refresh(ctx, domain)
+}
+
+func (c *OVH) RemoveTXTRecord(domain string, host string, value string) error {
+	ctx := context.Background()
+
+	ids := []int64{}
+	if err := c.request(ctx, http.MethodGet, "/domain/zone/"+domain+"/record", map[string]string{
+		"fieldType": "TXT",
+		"subDomain": host,
+	}, nil, &ids); err != nil {
+		return err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		rec := struct {
+			FieldType string `json:"fieldType"`
+			SubDomain string `json:"subDomain"`
+			Target    string `json:"target"`
+		}{}
+		endpoint := "/domain/zone/" + domain + "/record/" + strconv.FormatInt(id, 10)
+		if err := c.request(ctx, http.MethodGet, endpoint, nil, nil, &rec); err != nil {
+			return err
+		}
+
+		// txt targets may be returned quoted
+		if rec.FieldType != "TXT" || rec.SubDomain != host || strings.Trim(rec.Target, "\"") != value {
+			continue
+		}
+
+		if err := c.request(ctx, http.MethodDelete, endpoint, nil, nil, nil); err != nil {
+			return err
+		}
+		deleted++
+	}
+
+	if deleted == 0 {
+		return nil
+	}
+	return c.refresh(ctx, domain)
+}
+
+func (c *OVH) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
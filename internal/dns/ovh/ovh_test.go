@@ -0,0 +1,257 @@
+package ovh
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAppKey      = "app-key"
+	testAppSecret   = "app-secret"
+	testConsumerKey = "consumer-key"
+
+	// the server clock is ahead of ours
+	testTimeDelta = 1000
+)
+
+type testRecord struct {
+	ID        int64  `json:"id"`
+	FieldType string `json:"fieldType"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int    `json:"ttl"`
+}
+
+// fakeZone holds the records of example.com, and the signed requests received
+type fakeZone struct {
+	nextID   int64
+	records  map[int64]*testRecord
+	requests []string
+}
+
+func (z *fakeZone) add(fieldType string, subDomain string, target string) {
+	z.nextID++
+	z.records[z.nextID] = &testRecord{
+		ID:        z.nextID,
+		FieldType: fieldType,
+		SubDomain: subDomain,
+		Target:    target,
+	}
+}
+
+func checkSignature(t *testing.T, r *http.Request, body []byte) bool {
+	ts := r.Header.Get("X-Ovh-Timestamp")
+	h := sha1.Sum([]byte(strings.Join([]string{
+		testAppSecret,
+		testConsumerKey,
+		r.Method,
+		"http://" + r.Host + r.URL.RequestURI(),
+		string(body),
+		ts,
+	}, "+")))
+	if r.Header.Get("X-Ovh-Signature") != "$1$"+hex.EncodeToString(h[:]) {
+		t.Errorf("%s %s: invalid signature", r.Method, r.URL)
+		return false
+	}
+	if r.Header.Get("X-Ovh-Application") != testAppKey || r.Header.Get("X-Ovh-Consumer") != testConsumerKey {
+		t.Errorf("%s %s: invalid credentials", r.Method, r.URL)
+		return false
+	}
+
+	// signatures use the server time
+	tm, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Errorf("%s %s: invalid timestamp: %s", r.Method, r.URL, ts)
+		return false
+	}
+	if d := tm - (time.Now().Unix() + testTimeDelta); d < -5 || d > 5 {
+		t.Errorf("%s %s: timestamp not synchronized: %d", r.Method, r.URL, d)
+		return false
+	}
+	return true
+}
+
+func newFakeZone(t *testing.T, z *fakeZone) *httptest.Server {
+	const prefix = "/domain/zone/example.com/record"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/time" {
+			w.Write([]byte(strconv.FormatInt(time.Now().Unix()+testTimeDelta, 10)))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !checkSignature(t, r, body) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Invalid signature"})
+			return
+		}
+		z.requests = append(z.requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/auth/currentCredential":
+			json.NewEncoder(w).Encode(map[string]string{"status": "validated"})
+
+		case r.Method == http.MethodPost && r.URL.Path == "/domain/zone/example.com/refresh":
+			w.Write([]byte("null"))
+
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			rec := &testRecord{}
+			if err := json.Unmarshal(body, rec); err != nil {
+				t.Error(err)
+				return
+			}
+			z.nextID++
+			rec.ID = z.nextID
+			z.records[rec.ID] = rec
+			json.NewEncoder(w).Encode(rec)
+
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			// filters are ignored, the client must check the records
+			ids := []int64{}
+			for id := range z.records {
+				ids = append(ids, id)
+			}
+			json.NewEncoder(w).Encode(ids)
+
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, prefix+"/"), 10, 64)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			rec, found := z.records[id]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"message": "Record not found"})
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				json.NewEncoder(w).Encode(rec)
+			case http.MethodDelete:
+				delete(z.records, id)
+				w.Write([]byte("null"))
+			default:
+				t.Errorf("unexpected method: %s", r.Method)
+			}
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Not found"})
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestTimeSync(t *testing.T) {
+	ts := newFakeZone(t, &fakeZone{records: map[int64]*testRecord{}})
+
+	c, err := NewOVH(ts.URL, testAppKey, testAppSecret, testConsumerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := c.timeDelta - testTimeDelta*time.Second; d < -5*time.Second || d > 5*time.Second {
+		t.Errorf("unexpected time delta: %s", c.timeDelta)
+	}
+}
+
+func TestAddTXTRecord(t *testing.T) {
+	z := &fakeZone{records: map[int64]*testRecord{}}
+	ts := newFakeZone(t, z)
+
+	c, err := NewOVH(ts.URL, testAppKey, testAppSecret, testConsumerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.requests = nil
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"POST /domain/zone/example.com/record",
+		"POST /domain/zone/example.com/refresh",
+	}
+	if !reflect.DeepEqual(z.requests, expected) {
+		t.Errorf("unexpected requests: %q", z.requests)
+	}
+
+	if len(z.records) != 1 {
+		t.Fatalf("unexpected number of records: %d", len(z.records))
+	}
+	for _, rec := range z.records {
+		if rec.FieldType != "TXT" || rec.SubDomain != "_acme-challenge" || rec.Target != "foo" {
+			t.Errorf("unexpected record: %+v", rec)
+		}
+	}
+}
+
+func TestRemoveTXTRecord(t *testing.T) {
+	z := &fakeZone{records: map[int64]*testRecord{}}
+	z.add("TXT", "_acme-challenge", "bar")
+	z.add("TXT", "_acme-challenge", "\"foo\"")
+	z.add("TXT", "_acme-challenge.www", "foo")
+	z.add("CNAME", "_acme-challenge", "foo")
+	ts := newFakeZone(t, z)
+
+	c, err := NewOVH(ts.URL, testAppKey, testAppSecret, testConsumerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.requests = nil
+
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := z.requests
+	z.requests = nil
+	deleted := []string{}
+	for _, req := range r {
+		if strings.HasPrefix(req, "DELETE ") {
+			deleted = append(deleted, req)
+		}
+	}
+	if !reflect.DeepEqual(deleted, []string{"DELETE /domain/zone/example.com/record/2"}) {
+		t.Errorf("unexpected records deleted: %q", deleted)
+	}
+	if r[len(r)-1] != "POST /domain/zone/example.com/refresh" {
+		t.Errorf("zone not refreshed after removal: %q", r)
+	}
+
+	ids := []int64{}
+	for id := range z.records {
+		ids = append(ids, id)
+	}
+	if len(ids) != 3 || z.records[2] != nil {
+		t.Errorf("unexpected records left: %v", ids)
+	}
+
+	// nothing to remove, no refresh
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range z.requests {
+		if !strings.HasPrefix(req, "GET ") {
+			t.Errorf("unexpected request: %s", req)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package powerdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+type PowerDNS struct {
+	apiUrl   string
+	apiKey   string
+	serverID string
+}
+
+type record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type rrset struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	TTL        int       `json:"ttl,omitempty"`
+	ChangeType string    `json:"changetype,omitempty"`
+	Records    []*record `json:"records"`
+}
+
+func NewPowerDNS(apiUrl string, apiKey string, serverID string) (*PowerDNS, error) {
+	if apiUrl == "" {
+		return nil, fmt.Errorf("powerdns: api url not defined")
+	}
+	if serverID == "" {
+		serverID = "localhost"
+	}
+
+	rv := &PowerDNS{
+		apiUrl:   strings.TrimSuffix(apiUrl, "/"),
+		apiKey:   apiKey,
+		serverID: serverID,
+	}
+
+	// just check if authentication works
+	if err := rv.request(context.Background(), http.MethodGet, "", nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *PowerDNS) request(ctx context.Context, method string, endpoint string, args map[string]string, data interface{}, v interface{}) error {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return err
+	}
+	purl.Path = strings.TrimSuffix(purl.Path, "/") + "/api/v1/servers/" + url.PathEscape(c.serverID) + endpoint
+
+	pargs := url.Values{}
+	for k, v := range args {
+		pargs.Set(k, v)
+	}
+	purl.RawQuery = pargs.Encode()
+
+	var rbody io.Reader
+	if data != nil {
+		a, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		rbody = bytes.NewBuffer(a)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	req.Header.Add("X-API-Key", c.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		e := struct {
+			Error string `json:"error"`
+		}{}
+		if err := json.Unmarshal(body, &e); err != nil || e.Error == "" {
+			return fmt.Errorf("powerdns: request failed (%d): %s", resp.StatusCode, body)
+		}
+		return fmt.Errorf("powerdns: request failed (%d): %s", resp.StatusCode, e.Error)
+	}
+
+	if v != nil {
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+func (c *PowerDNS) getZoneEndpoint(domain string) string {
+	return "/zones/" + url.PathEscape(strings.TrimSuffix(domain, ".")+".")
+}
+
+func (c *PowerDNS) getRRSet(ctx context.Context, domain string, name string) (*rrset, error) {
+	v := struct {
+		RRSets []*rrset `json:"rrsets"`
+	}{}
+
+	// older servers ignore the filters and return the whole zone
+	if err := c.request(ctx, http.MethodGet, c.getZoneEndpoint(domain), map[string]string{
+		"rrset_name": name,
+		"rrset_type": "TXT",
+	}, nil, &v); err != nil {
+		return nil, err
+	}
+
+	for _, r := range v.RRSets {
+		if r.Name == name && r.Type == "TXT" {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *PowerDNS) update(ctx context.Context, domain string, host string, value string, remove bool) error {
+	name := host + "." + strings.TrimSuffix(domain, ".") + "."
+	quoted := strconv.Quote(value)
+
+	current, err := c.getRRSet(ctx, domain, name)
+	if err != nil {
+		return err
+	}
+
+	// a REPLACE change overwrites all the records of the rrset, so the
+	// current records are sent back along with ours.
+	r := &rrset{
+		Name:       name,
+		Type:       "TXT",
+		TTL:        60,
+		ChangeType: "REPLACE",
+		Records:    []*record{},
+	}
+	found := false
+	if current != nil {
+		if current.TTL > 0 {
+			r.TTL = current.TTL
+		}
+		for _, rec := range current.Records {
+			if rec.Content == quoted {
+				found = true
+				if remove {
+					continue
+				}
+			}
+			r.Records = append(r.Records, rec)
+		}
+	}
+
+	if remove {
+		if !found {
+			return nil
+		}
+		if len(r.Records) == 0 {
+			r.ChangeType = "DELETE"
+			r.TTL = 0
+		}
+	} else {
+		if found {
+			return nil
+		}
+		r.Records = append(r.Records, &record{Content: quoted})
+	}
+
+	return c.request(ctx, http.MethodPatch, c.getZoneEndpoint(domain), nil, map[string]interface{}{
+		"rrsets": []*rrset{r},
+	}, nil)
+}
+
+func (c *PowerDNS) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	return c.update(ctx, domain, host, value, false)
+}
+
+func (c *PowerDNS) RemoveTXTRecord(domain string, host string, value string) error {
+	return c.update(context.Background(), domain, host, value, true)
+}
+
+func (c *PowerDNS) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
@@ -0,0 +1,135 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testApiKey = "secret"
+
+// newFakeZone serves a single zone, example.com., ignoring the rrset filters
+// like older servers do.
+func newFakeZone(t *testing.T, rrsets map[string]*rrset) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != testApiKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized"))
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/pdns/api/v1/servers/localhost":
+			json.NewEncoder(w).Encode(map[string]string{"id": "localhost"})
+
+		case r.Method == http.MethodGet && r.URL.Path == "/pdns/api/v1/servers/localhost/zones/example.com.":
+			v := struct {
+				RRSets []*rrset `json:"rrsets"`
+			}{
+				RRSets: []*rrset{},
+			}
+			for _, r := range rrsets {
+				v.RRSets = append(v.RRSets, r)
+			}
+			json.NewEncoder(w).Encode(v)
+
+		case r.Method == http.MethodPatch && r.URL.Path == "/pdns/api/v1/servers/localhost/zones/example.com.":
+			v := struct {
+				RRSets []*rrset `json:"rrsets"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Error(err)
+				return
+			}
+			for _, r := range v.RRSets {
+				switch r.ChangeType {
+				case "REPLACE":
+					r.ChangeType = ""
+					rrsets[r.Name] = r
+				case "DELETE":
+					delete(rrsets, r.Name)
+				default:
+					t.Errorf("unexpected change type: %s", r.ChangeType)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Not Found"})
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func getContents(r *rrset) []string {
+	if r == nil {
+		return nil
+	}
+	rv := []string{}
+	for _, rec := range r.Records {
+		rv = append(rv, rec.Content)
+	}
+	return rv
+}
+
+// the challenges for example.com and *.example.com share the same name
+func TestAddRemoveTXTRecord(t *testing.T) {
+	rrsets := map[string]*rrset{
+		"_acme-challenge.www.example.com.": {
+			Name:    "_acme-challenge.www.example.com.",
+			Type:    "TXT",
+			TTL:     300,
+			Records: []*record{{Content: `"other"`}},
+		},
+	}
+	ts := newFakeZone(t, rrsets)
+
+	c, err := NewPowerDNS(ts.URL+"/pdns/", testApiKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const name = "_acme-challenge.example.com."
+	for _, step := range []struct {
+		remove   bool
+		value    string
+		expected []string
+	}{
+		{false, "foo", []string{`"foo"`}},
+		{false, "bar", []string{`"foo"`, `"bar"`}},
+		{false, "bar", []string{`"foo"`, `"bar"`}},
+		{true, "foo", []string{`"bar"`}},
+		{true, "foo", []string{`"bar"`}},
+		{true, "bar", nil},
+	} {
+		if step.remove {
+			err = c.RemoveTXTRecord("example.com", "_acme-challenge", step.value)
+		} else {
+			err = c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", step.value)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := getContents(rrsets[name]); !reflect.DeepEqual(v, step.expected) {
+			t.Fatalf("remove=%t %s: unexpected records: %q", step.remove, step.value, v)
+		}
+	}
+
+	if v := getContents(rrsets["_acme-challenge.www.example.com."]); !reflect.DeepEqual(v, []string{`"other"`}) {
+		t.Errorf("unrelated rrset changed: %q", v)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newFakeZone(t, nil)
+
+	if _, err := NewPowerDNS(ts.URL+"/pdns", "bad-key", ""); err == nil {
+		t.Error("bad key accepted")
+	}
+}
@@ -0,0 +1,147 @@
+package rfc2136
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+var algorithms = map[string]string{
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+type RFC2136 struct {
+	server    string
+	protocol  string
+	keyName   string
+	algorithm string
+	secret    string
+}
+
+func NewRFC2136(server string, protocol string, keyName string, algorithm string, secret string) (*RFC2136, error) {
+	if server == "" {
+		return nil, fmt.Errorf("rfc2136: server not defined")
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	if protocol == "" {
+		protocol = "udp"
+	}
+	if protocol != "udp" && protocol != "tcp" {
+		return nil, fmt.Errorf("rfc2136: invalid protocol: %s", protocol)
+	}
+
+	rv := &RFC2136{
+		server:   server,
+		protocol: protocol,
+	}
+
+	if keyName != "" || secret != "" {
+		if keyName == "" || secret == "" {
+			return nil, fmt.Errorf("rfc2136: tsig key name and secret must be defined together")
+		}
+		if algorithm == "" {
+			algorithm = "hmac-sha256"
+		}
+		algo, found := algorithms[strings.ToLower(algorithm)]
+		if !found {
+			return nil, fmt.Errorf("rfc2136: invalid tsig algorithm: %s", algorithm)
+		}
+		if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+			return nil, fmt.Errorf("rfc2136: tsig secret is not valid base64: %w", err)
+		}
+		rv.keyName = dns.Fqdn(keyName)
+		rv.algorithm = algo
+		rv.secret = secret
+	}
+
+	return rv, nil
+}
+
+func (c *RFC2136) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	client := &dns.Client{
+		Net:     c.protocol,
+		Timeout: 10 * time.Second,
+	}
+	if c.keyName != "" {
+		client.TsigSecret = map[string]string{c.keyName: c.secret}
+		m.SetTsig(c.keyName, c.algorithm, 300, time.Now().Unix())
+	}
+
+	r, _, err := client.ExchangeContext(ctx, m, c.server)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: request failed: %w", err)
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("rfc2136: request failed: %s", dns.RcodeToString[r.Rcode])
+	}
+	return r, nil
+}
+
+func (c *RFC2136) update(ctx context.Context, domain string, host string, value string, remove bool) error {
+	zone := dns.Fqdn(domain)
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   host + "." + zone,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		Txt: []string{value},
+	}
+
+	// only the record with our value is touched, other values of the same
+	// name are preserved.
+	m := &dns.Msg{}
+	m.SetUpdate(zone)
+	if remove {
+		m.Remove([]dns.RR{rr})
+	} else {
+		m.Insert([]dns.RR{rr})
+	}
+
+	_, err := c.exchange(ctx, m)
+	return err
+}
+
+func (c *RFC2136) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	return c.update(ctx, domain, host, value, false)
+}
+
+func (c *RFC2136) RemoveTXTRecord(domain string, host string, value string) error {
+	return c.update(context.Background(), domain, host, value, true)
+}
+
+func (c *RFC2136) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(host+"."+dns.Fqdn(domain), dns.TypeTXT)
+
+	r, err := c.exchange(ctx, m)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	// the update server may be a hidden primary, wait for the name servers
+	return utils.CheckTXTFromNS(domain, host, value)
+}
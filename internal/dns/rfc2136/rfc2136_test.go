@@ -0,0 +1,196 @@
+package rfc2136
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testKeyName = "ledns."
+	testSecret  = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0MTI="
+)
+
+type fakeServer struct {
+	addr    string
+	mtx     sync.Mutex
+	records map[string][]string
+	updates [][]dns.RR
+	server  *dns.Server
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv := &fakeServer{
+		addr:    pc.LocalAddr().String(),
+		records: map[string][]string{},
+	}
+
+	started := make(chan struct{})
+	rv.server = &dns.Server{
+		PacketConn:        pc,
+		TsigSecret:        map[string]string{testKeyName: testSecret},
+		Handler:           dns.HandlerFunc(rv.handle),
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			// the default function rejects updates
+			if int(dh.Bits>>11)&0xf == dns.OpcodeUpdate {
+				return dns.MsgAccept
+			}
+			return dns.DefaultMsgAcceptFunc(dh)
+		},
+	}
+	go rv.server.ActivateAndServe()
+	t.Cleanup(func() { rv.server.Shutdown() })
+	<-started
+
+	return rv
+}
+
+func (s *fakeServer) handle(w dns.ResponseWriter, r *dns.Msg) {
+	m := &dns.Msg{}
+	m.SetReply(r)
+
+	// like bind, unsigned requests and requests with bad signatures are
+	// rejected
+	tsig := r.IsTsig()
+	if tsig == nil || w.TsigStatus() != nil {
+		m.Rcode = dns.RcodeNotAuth
+		w.WriteMsg(m)
+		return
+	}
+	m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch r.Opcode {
+	case dns.OpcodeUpdate:
+		s.updates = append(s.updates, r.Ns)
+		for _, rr := range r.Ns {
+			txt, ok := rr.(*dns.TXT)
+			if !ok {
+				m.Rcode = dns.RcodeRefused
+				break
+			}
+			name := strings.ToLower(txt.Hdr.Name)
+			value := strings.Join(txt.Txt, "")
+
+			switch txt.Hdr.Class {
+			case dns.ClassINET:
+				s.records[name] = append(s.records[name], value)
+			case dns.ClassNONE:
+				values := []string{}
+				for _, v := range s.records[name] {
+					if v != value {
+						values = append(values, v)
+					}
+				}
+				s.records[name] = values
+			default:
+				m.Rcode = dns.RcodeRefused
+			}
+		}
+
+	case dns.OpcodeQuery:
+		for _, q := range r.Question {
+			for _, v := range s.records[strings.ToLower(q.Name)] {
+				m.Answer = append(m.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+					Txt: []string{v},
+				})
+			}
+		}
+	}
+
+	w.WriteMsg(m)
+}
+
+func (s *fakeServer) get(name string) []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	rv := append([]string{}, s.records[name]...)
+	sort.Strings(rv)
+	return rv
+}
+
+func TestUpdate(t *testing.T) {
+	s := newFakeServer(t)
+	s.records["_acme-challenge.example.com."] = []string{"other"}
+
+	c, err := NewRFC2136(s.addr, "udp", "ledns", "hmac-sha256", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.get("_acme-challenge.example.com."); !reflect.DeepEqual(v, []string{"foo", "other"}) {
+		t.Errorf("unexpected records after insert: %q", v)
+	}
+
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.get("_acme-challenge.example.com."); !reflect.DeepEqual(v, []string{"other"}) {
+		t.Errorf("unexpected records after remove: %q", v)
+	}
+
+	// both updates must only touch our rr, never the whole rrset
+	if len(s.updates) != 2 {
+		t.Fatalf("unexpected number of updates: %d", len(s.updates))
+	}
+	for i, class := range []uint16{dns.ClassINET, dns.ClassNONE} {
+		if len(s.updates[i]) != 1 {
+			t.Fatalf("update %d: unexpected number of rrs: %d", i, len(s.updates[i]))
+		}
+		txt, ok := s.updates[i][0].(*dns.TXT)
+		if !ok {
+			t.Fatalf("update %d: unexpected rr: %s", i, s.updates[i][0])
+		}
+		if txt.Hdr.Class != class || txt.Hdr.Name != "_acme-challenge.example.com." || !reflect.DeepEqual(txt.Txt, []string{"foo"}) {
+			t.Errorf("update %d: unexpected rr: %s", i, txt)
+		}
+	}
+}
+
+func TestUpdateBadKey(t *testing.T) {
+	s := newFakeServer(t)
+
+	for _, tc := range []struct {
+		name    string
+		keyName string
+		secret  string
+	}{
+		{"wrong secret", "ledns", "d3Jvbmd3cm9uZ3dyb25nd3Jvbmd3cm9uZ3dyb25nMTI="},
+		{"wrong key name", "other", testSecret},
+		{"unsigned", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewRFC2136(s.addr, "udp", tc.keyName, "hmac-sha256", tc.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err == nil {
+				t.Error("update not rejected")
+			}
+		})
+	}
+
+	if v := s.get("_acme-challenge.example.com."); len(v) != 0 {
+		t.Errorf("unexpected records: %q", v)
+	}
+}
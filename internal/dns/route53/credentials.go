@@ -0,0 +1,125 @@
+package route53
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+func getEnvCredentials() *credentials {
+	rv := &credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if rv.accessKeyID == "" || rv.secretAccessKey == "" {
+		return nil
+	}
+	return rv
+}
+
+func getFileCredentials(profile string) (*credentials, error) {
+	fpath := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if fpath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		fpath = filepath.Join(home, ".aws", "credentials")
+	}
+
+	fp, err := os.Open(fpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	rv := &credentials{}
+	found := false
+	section := ""
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		found = true
+		switch v := strings.TrimSpace(kv[1]); strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			rv.accessKeyID = v
+		case "aws_secret_access_key":
+			rv.secretAccessKey = v
+		case "aws_session_token":
+			rv.sessionToken = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, nil
+	}
+	if rv.accessKeyID == "" || rv.secretAccessKey == "" {
+		return nil, fmt.Errorf("route53: incomplete credentials for profile %q: %s", profile, fpath)
+	}
+	return rv, nil
+}
+
+// static credentials, then environment variables, then the shared
+// credentials file, like the aws cli.
+func getCredentials(accessKeyID string, secretAccessKey string, sessionToken string, profile string) (*credentials, error) {
+	if accessKeyID != "" || secretAccessKey != "" {
+		if accessKeyID == "" || secretAccessKey == "" {
+			return nil, fmt.Errorf("route53: access key id and secret access key must be defined together")
+		}
+		return &credentials{
+			accessKeyID:     accessKeyID,
+			secretAccessKey: secretAccessKey,
+			sessionToken:    sessionToken,
+		}, nil
+	}
+
+	if profile == "" {
+		if rv := getEnvCredentials(); rv != nil {
+			return rv, nil
+		}
+		profile = os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = "default"
+		}
+	}
+
+	rv, err := getFileCredentials(profile)
+	if err != nil {
+		return nil, err
+	}
+	if rv == nil {
+		return nil, fmt.Errorf("route53: no credentials found")
+	}
+	return rv, nil
+}
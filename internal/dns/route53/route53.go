@@ -0,0 +1,310 @@
+package route53
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://route53.amazonaws.com"
+	namespace     = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+	// route 53 is a global service, signed for us-east-1
+	region  = "us-east-1"
+	service = "route53"
+)
+
+type Route53 struct {
+	creds   *credentials
+	apiUrl  string
+	changes map[string]string
+	mtx     sync.Mutex
+}
+
+type resourceRecord struct {
+	Value string `xml:"Value"`
+}
+
+type resourceRecordSet struct {
+	Name            string           `xml:"Name"`
+	Type            string           `xml:"Type"`
+	TTL             int              `xml:"TTL"`
+	ResourceRecords []resourceRecord `xml:"ResourceRecords>ResourceRecord"`
+}
+
+type changeInfo struct {
+	ID     string `xml:"ChangeInfo>Id"`
+	Status string `xml:"ChangeInfo>Status"`
+}
+
+// apiUrl is optional, and defaults to the public api
+func NewRoute53(apiUrl string, accessKeyID string, secretAccessKey string, sessionToken string, profile string) (*Route53, error) {
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	creds, err := getCredentials(accessKeyID, secretAccessKey, sessionToken, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &Route53{
+		creds:   creds,
+		apiUrl:  apiUrl,
+		changes: map[string]string{},
+	}
+
+	// just check if authentication works
+	if err := rv.request(context.Background(), http.MethodGet, "/2013-04-01/hostedzonesbyname", map[string]string{
+		"maxitems": "1",
+	}, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *Route53) request(ctx context.Context, method string, endpoint string, args map[string]string, data interface{}, v interface{}) error {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return err
+	}
+	purl.Path = endpoint
+	purl.RawQuery = canonicalQuery(args)
+
+	var (
+		body  []byte
+		rbody io.Reader
+	)
+	if data != nil {
+		a, err := xml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		body = append([]byte(xml.Header), a...)
+		rbody = bytes.NewBuffer(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/xml")
+	}
+	req.Header.Set("X-Amz-Content-Sha256", sha256Hex(body))
+
+	sign(req, body, c.creds, region, service, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	rbytes, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}{}
+		if err := xml.Unmarshal(rbytes, &e); err != nil || e.Code == "" {
+			return fmt.Errorf("route53: request failed (%d): %s", resp.StatusCode, rbytes)
+		}
+		return fmt.Errorf("route53: request failed (%d): %s: %s", resp.StatusCode, e.Code, e.Message)
+	}
+
+	if v != nil {
+		return xml.Unmarshal(rbytes, v)
+	}
+	return nil
+}
+
+func (c *Route53) getZoneID(ctx context.Context, domain string) (string, error) {
+	name := strings.TrimSuffix(domain, ".") + "."
+
+	v := struct {
+		HostedZones []struct {
+			ID          string `xml:"Id"`
+			Name        string `xml:"Name"`
+			PrivateZone bool   `xml:"Config>PrivateZone"`
+		} `xml:"HostedZones>HostedZone"`
+	}{}
+	if err := c.request(ctx, http.MethodGet, "/2013-04-01/hostedzonesbyname", map[string]string{
+		"dnsname":  name,
+		"maxitems": "100",
+	}, nil, &v); err != nil {
+		return "", err
+	}
+
+	// results are sorted by name, starting with the requested one. private
+	// zones are not visible to the ca.
+	rv := ""
+	for _, zone := range v.HostedZones {
+		if zone.Name != name || zone.PrivateZone {
+			continue
+		}
+		if rv != "" {
+			return "", fmt.Errorf("route53: more than one zone found: %s", domain)
+		}
+		rv = strings.TrimPrefix(zone.ID, "/hostedzone/")
+	}
+
+	if rv == "" {
+		return "", fmt.Errorf("route53: zone not found: %s", domain)
+	}
+	return rv, nil
+}
+
+func (c *Route53) getRecordSet(ctx context.Context, zid string, name string) (*resourceRecordSet, error) {
+	v := struct {
+		ResourceRecordSets []*resourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}{}
+	if err := c.request(ctx, http.MethodGet, "/2013-04-01/hostedzone/"+zid+"/rrset", map[string]string{
+		"name":     name,
+		"type":     "TXT",
+		"maxitems": "1",
+	}, nil, &v); err != nil {
+		return nil, err
+	}
+
+	// listing starts at the requested name, but may return the next one
+	for _, rrset := range v.ResourceRecordSets {
+		if rrset.Name == name && rrset.Type == "TXT" {
+			return rrset, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Route53) change(ctx context.Context, zid string, action string, rrset *resourceRecordSet) (string, error) {
+	type change struct {
+		Action            string             `xml:"Action"`
+		ResourceRecordSet *resourceRecordSet `xml:"ResourceRecordSet"`
+	}
+	data := struct {
+		XMLName xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Changes []change `xml:"ChangeBatch>Changes>Change"`
+	}{
+		XMLNS: namespace,
+		Changes: []change{
+			{
+				Action:            action,
+				ResourceRecordSet: rrset,
+			},
+		},
+	}
+
+	v := changeInfo{}
+	if err := c.request(ctx, http.MethodPost, "/2013-04-01/hostedzone/"+zid+"/rrset/", nil, data, &v); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(v.ID, "/change/"), nil
+}
+
+func (c *Route53) update(ctx context.Context, domain string, host string, value string, remove bool) (string, error) {
+	zid, err := c.getZoneID(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+
+	name := host + "." + strings.TrimSuffix(domain, ".") + "."
+	quoted := strconv.Quote(value)
+
+	current, err := c.getRecordSet(ctx, zid, name)
+	if err != nil {
+		return "", err
+	}
+
+	// an UPSERT replaces the whole record set, so it must include the
+	// current values.
+	rrset := &resourceRecordSet{
+		Name: name,
+		Type: "TXT",
+		TTL:  60,
+	}
+	found := false
+	if current != nil {
+		rrset.TTL = current.TTL
+		for _, rr := range current.ResourceRecords {
+			if rr.Value == quoted {
+				found = true
+				if remove {
+					continue
+				}
+			}
+			rrset.ResourceRecords = append(rrset.ResourceRecords, rr)
+		}
+	}
+
+	if remove {
+		if !found {
+			return "", nil
+		}
+		if len(rrset.ResourceRecords) == 0 {
+			// deletions must match the current record set exactly
+			return c.change(ctx, zid, "DELETE", current)
+		}
+		return c.change(ctx, zid, "UPSERT", rrset)
+	}
+
+	if !found {
+		rrset.ResourceRecords = append(rrset.ResourceRecords, resourceRecord{quoted})
+	}
+	return c.change(ctx, zid, "UPSERT", rrset)
+}
+
+func (c *Route53) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	id, err := c.update(ctx, domain, host, value, false)
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	c.changes[host+"."+domain+" "+value] = id
+	c.mtx.Unlock()
+	return nil
+}
+
+func (c *Route53) RemoveTXTRecord(domain string, host string, value string) error {
+	c.mtx.Lock()
+	delete(c.changes, host+"."+domain+" "+value)
+	c.mtx.Unlock()
+
+	_, err := c.update(context.Background(), domain, host, value, true)
+	return err
+}
+
+func (c *Route53) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	c.mtx.Lock()
+	id, found := c.changes[host+"."+domain+" "+value]
+	c.mtx.Unlock()
+
+	if !found {
+		return utils.CheckTXTFromNS(domain, host, value)
+	}
+
+	// changes are INSYNC once propagated to all route 53 name servers
+	v := changeInfo{}
+	if err := c.request(ctx, http.MethodGet, "/2013-04-01/change/"+id, nil, nil, &v); err != nil {
+		return false, err
+	}
+	return v.Status == "INSYNC", nil
+}
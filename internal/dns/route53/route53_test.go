@@ -0,0 +1,221 @@
+package route53
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "secret"
+)
+
+type fakeAPI struct {
+	t       *testing.T
+	mtx     sync.Mutex
+	rrsets  map[string]*resourceRecordSet
+	actions []string
+}
+
+// the signature is verified by signing a copy of the request without the
+// authorization header, with the same date.
+func (f *fakeAPI) checkSignature(r *http.Request, body []byte) bool {
+	now, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	for k, v := range r.Header {
+		if k != "Authorization" && k != "X-Amz-Date" {
+			req.Header[k] = v
+		}
+	}
+	sign(req, body, &credentials{
+		accessKeyID:     testAccessKeyID,
+		secretAccessKey: testSecretAccessKey,
+	}, region, service, now)
+
+	return req.Header.Get("Authorization") == r.Header.Get("Authorization") &&
+		r.Header.Get("X-Amz-Content-Sha256") == sha256Hex(body)
+}
+
+func (f *fakeAPI) writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header + "<ErrorResponse><Error><Code>" + code + "</Code><Message>" + message + "</Message></Error></ErrorResponse>"))
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.t.Error(err)
+		return
+	}
+	if !f.checkSignature(r, body) {
+		f.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "invalid signature")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzonesbyname":
+		w.Write([]byte(`<ListHostedZonesByNameResponse><HostedZones>
+			<HostedZone><Id>/hostedzone/PRIVATE</Id><Name>example.com.</Name><Config><PrivateZone>true</PrivateZone></Config></HostedZone>
+			<HostedZone><Id>/hostedzone/ZONE</Id><Name>example.com.</Name><Config><PrivateZone>false</PrivateZone></Config></HostedZone>
+			<HostedZone><Id>/hostedzone/OTHER</Id><Name>foo.example.com.</Name><Config><PrivateZone>false</PrivateZone></Config></HostedZone>
+		</HostedZones></ListHostedZonesByNameResponse>`))
+
+	case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzone/ZONE/rrset":
+		// listing starts at the requested name, and returns the next one if
+		// not found
+		names := []string{}
+		for name := range f.rrsets {
+			if name >= r.URL.Query().Get("name") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		v := struct {
+			XMLName            xml.Name             `xml:"ListResourceRecordSetsResponse"`
+			ResourceRecordSets []*resourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+		}{}
+		if len(names) > 0 {
+			v.ResourceRecordSets = append(v.ResourceRecordSets, f.rrsets[names[0]])
+		}
+		xml.NewEncoder(w).Encode(v)
+
+	case r.Method == http.MethodPost && r.URL.Path == "/2013-04-01/hostedzone/ZONE/rrset/":
+		v := struct {
+			Changes []struct {
+				Action            string             `xml:"Action"`
+				ResourceRecordSet *resourceRecordSet `xml:"ResourceRecordSet"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}{}
+		if err := xml.Unmarshal(body, &v); err != nil {
+			f.t.Error(err)
+			return
+		}
+		for _, c := range v.Changes {
+			rrset := c.ResourceRecordSet
+			values := []string{}
+			for _, rr := range rrset.ResourceRecords {
+				values = append(values, rr.Value)
+			}
+			f.actions = append(f.actions, c.Action+" "+rrset.Name+" "+strings.Join(values, ","))
+
+			switch c.Action {
+			case "UPSERT":
+				f.rrsets[rrset.Name] = rrset
+			case "DELETE":
+				if !reflect.DeepEqual(f.rrsets[rrset.Name], rrset) {
+					f.writeError(w, http.StatusBadRequest, "InvalidChangeBatch", "record set does not match")
+					return
+				}
+				delete(f.rrsets, rrset.Name)
+			default:
+				f.t.Errorf("unexpected action: %s", c.Action)
+			}
+		}
+		w.Write([]byte(`<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/CHANGE</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+
+	case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/change/CHANGE":
+		w.Write([]byte(`<GetChangeResponse><ChangeInfo><Id>/change/CHANGE</Id><Status>INSYNC</Status></ChangeInfo></GetChangeResponse>`))
+
+	default:
+		f.t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		f.writeError(w, http.StatusNotFound, "NotFound", "not found")
+	}
+}
+
+func (f *fakeAPI) getActions() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	rv := f.actions
+	f.actions = nil
+	return rv
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := httptest.NewServer(&fakeAPI{t: t})
+	defer ts.Close()
+
+	if _, err := NewRoute53(ts.URL, testAccessKeyID, "bad-secret", "", ""); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("bad secret not rejected: %v", err)
+	}
+	if _, err := NewRoute53(ts.URL, testAccessKeyID, testSecretAccessKey, "", ""); err != nil {
+		t.Error(err)
+	}
+}
+
+// the challenges for example.com and *.example.com share the same name
+func TestAddRemoveTXTRecord(t *testing.T) {
+	f := &fakeAPI{
+		t: t,
+		rrsets: map[string]*resourceRecordSet{
+			"_acme-challenge.www.example.com.": {
+				Name:            "_acme-challenge.www.example.com.",
+				Type:            "TXT",
+				TTL:             300,
+				ResourceRecords: []resourceRecord{{`"other"`}},
+			},
+		},
+	}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	c, err := NewRoute53(ts.URL, testAccessKeyID, testSecretAccessKey, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := c.CheckTXTRecord(context.Background(), "example.com", "_acme-challenge", "bar"); err != nil || !found {
+		t.Errorf("change not in sync: %v", err)
+	}
+
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`UPSERT _acme-challenge.example.com. "foo"`,
+		`UPSERT _acme-challenge.example.com. "foo","bar"`,
+		`UPSERT _acme-challenge.example.com. "bar"`,
+		`DELETE _acme-challenge.example.com. "bar"`,
+	}
+	if a := f.getActions(); !reflect.DeepEqual(a, expected) {
+		t.Errorf("unexpected changes:\ngot:      %q\nexpected: %q", a, expected)
+	}
+
+	if len(f.rrsets) != 1 || f.rrsets["_acme-challenge.www.example.com."] == nil {
+		t.Errorf("unexpected record sets left: %v", f.rrsets)
+	}
+}
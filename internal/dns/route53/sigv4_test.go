@@ -0,0 +1,77 @@
+package route53
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// vectors from the aws signature version 4 test suite
+func TestSign(t *testing.T) {
+	creds := &credentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name          string
+		method        string
+		args          map[string]string
+		contentType   string
+		body          string
+		signedHeaders string
+		signature     string
+	}{
+		{
+			name:          "get-vanilla",
+			method:        http.MethodGet,
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "get-vanilla-query-order-key-case",
+			method:        http.MethodGet,
+			args:          map[string]string{"Param2": "value2", "Param1": "value1"},
+			signedHeaders: "host;x-amz-date",
+			signature:     "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:          "post-vanilla",
+			method:        http.MethodPost,
+			signedHeaders: "host;x-amz-date",
+			signature:     "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:          "post-x-www-form-urlencoded",
+			method:        http.MethodPost,
+			contentType:   "application/x-www-form-urlencoded",
+			body:          "Param1=value1",
+			signedHeaders: "content-type;host;x-amz-date",
+			signature:     "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "https://example.amazonaws.com/", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.URL.RawQuery = canonicalQuery(tc.args)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			sign(req, []byte(tc.body), creds, "us-east-1", "service", now)
+
+			expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=" +
+				tc.signedHeaders + ", Signature=" + tc.signature
+			if auth := req.Header.Get("Authorization"); auth != expected {
+				t.Errorf("unexpected authorization:\ngot:      %s\nexpected: %s", auth, expected)
+			}
+			if date := req.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+				t.Errorf("unexpected date: %s", date)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package vultr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rafaelmartins/ledns/internal/dns/utils"
+)
+
+const (
+	defaultApiUrl = "https://api.vultr.com"
+)
+
+type Vultr struct {
+	apiKey string
+	apiUrl string
+}
+
+// apiUrl is optional, and defaults to the public api
+func NewVultr(apiUrl string, apiKey string) (*Vultr, error) {
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	rv := &Vultr{
+		apiKey: apiKey,
+		apiUrl: apiUrl,
+	}
+
+	// just check if authentication works
+	if err := rv.request(context.Background(), http.MethodGet, "/v2/account", nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (c *Vultr) request(ctx context.Context, method string, endpoint string, args map[string]string, data map[string]interface{}, v interface{}) error {
+	purl, err := url.ParseRequestURI(c.apiUrl)
+	if err != nil {
+		return err
+	}
+	purl.Path = endpoint
+
+	pargs := url.Values{}
+	for k, v := range args {
+		pargs.Set(k, v)
+	}
+	purl.RawQuery = pargs.Encode()
+
+	var rbody io.Reader
+	if data != nil {
+		a, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		rbody = bytes.NewBuffer(a)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, purl.String(), rbody)
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	req.Header.Add("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		e := struct {
+			Error string `json:"error"`
+		}{}
+		if err := json.Unmarshal(body, &e); err != nil {
+			return fmt.Errorf("vultr: request failed (%d): %s", resp.StatusCode, body)
+		}
+		return fmt.Errorf("vultr: request failed (%d): %s", resp.StatusCode, e.Error)
+	}
+
+	if v != nil {
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+func (c *Vultr) AddTXTRecord(ctx context.Context, domain string, host string, value string) error {
+	// vultr requires txt data to be quoted
+	return c.request(ctx, http.MethodPost, "/v2/domains/"+domain+"/records", nil, map[string]interface{}{
+		"type": "TXT",
+		"name": host,
+		"data": strconv.Quote(value),
+		"ttl":  120,
+	}, nil)
+}
+
+func (c *Vultr) RemoveTXTRecord(domain string, host string, value string) error {
+	ids := []string{}
+	cursor := ""
+	for {
+		args := map[string]string{
+			"per_page": "500",
+		}
+		if cursor != "" {
+			args["cursor"] = cursor
+		}
+
+		v := struct {
+			Records []struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+				Name string `json:"name"`
+				Data string `json:"data"`
+			} `json:"records"`
+			Meta struct {
+				Links struct {
+					Next string `json:"next"`
+				} `json:"links"`
+			} `json:"meta"`
+		}{}
+		if err := c.request(context.Background(), http.MethodGet, "/v2/domains/"+domain+"/records", args, nil, &v); err != nil {
+			return err
+		}
+
+		for _, rec := range v.Records {
+			if rec.Name == host && rec.Type == "TXT" && strings.Trim(rec.Data, "\"") == value {
+				ids = append(ids, rec.ID)
+			}
+		}
+
+		if v.Meta.Links.Next == "" {
+			break
+		}
+		cursor = v.Meta.Links.Next
+	}
+
+	for _, id := range ids {
+		if err := c.request(context.Background(), http.MethodDelete, "/v2/domains/"+domain+"/records/"+id, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Vultr) CheckTXTRecord(ctx context.Context, domain string, host string, value string) (bool, error) {
+	return utils.CheckTXTFromNS(domain, host, value)
+}
@@ -0,0 +1,109 @@
+package vultr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testApiKey = "secret"
+
+type testRecord struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+func TestAddRemoveTXTRecord(t *testing.T) {
+	records := []*testRecord{
+		{"rec1", "TXT", "_acme-challenge", `"bar"`, 120},
+		{"rec2", "TXT", "_acme-challenge.www", `"foo"`, 120},
+		{"rec3", "CNAME", "_acme-challenge", "foo", 120},
+	}
+	deleted := []string{}
+
+	const prefix = "/v2/domains/example.com/records"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testApiKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid API token."})
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/account":
+			json.NewEncoder(w).Encode(map[string]interface{}{"account": map[string]string{"name": "test"}})
+
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			rec := &testRecord{}
+			if err := json.NewDecoder(r.Body).Decode(rec); err != nil {
+				t.Error(err)
+				return
+			}
+			rec.ID = "rec" + strconv.Itoa(len(records)+1)
+			records = append(records, rec)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"record": rec})
+
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			// pages have 2 records, the cursor is the next index
+			start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+			data := []*testRecord{}
+			for i := start; i < len(records) && i < start+2; i++ {
+				data = append(data, records[i])
+			}
+			next := ""
+			if start+2 < len(records) {
+				next = strconv.Itoa(start + 2)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"records": data,
+				"meta":    map[string]interface{}{"links": map[string]string{"next": next}},
+			})
+
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, prefix+"/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, prefix+"/"))
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+		}
+	}))
+	defer ts.Close()
+
+	if _, err := NewVultr(ts.URL, "bad-key"); err == nil {
+		t.Error("bad api key accepted")
+	}
+
+	c, err := NewVultr(ts.URL, testApiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddTXTRecord(context.Background(), "example.com", "_acme-challenge", "baz"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := records[3]; rec.Type != "TXT" || rec.Name != "_acme-challenge" || rec.Data != `"foo"` {
+		t.Errorf("unexpected record created: %+v", rec)
+	}
+
+	// the record is only found in the second page
+	if err := c.RemoveTXTRecord("example.com", "_acme-challenge", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"rec4"}) {
+		t.Errorf("unexpected records deleted: %q", deleted)
+	}
+}
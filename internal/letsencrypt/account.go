@@ -0,0 +1,277 @@
+package letsencrypt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+type Account struct {
+	Emails     []string
+	EABKeyID   string
+	EABHMACKey []byte
+}
+
+type accountInfo struct {
+	URI      string   `json:"uri,omitempty"`
+	Contact  []string `json:"contact,omitempty"`
+	EABKeyID string   `json:"eab-kid,omitempty"`
+}
+
+func (a *Account) getContact() []string {
+	rv := []string{}
+	for _, email := range a.Emails {
+		rv = append(rv, "mailto:"+email)
+	}
+	return rv
+}
+
+func contactEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, i := range a {
+		found := false
+		for _, j := range b {
+			if i == j {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *LetsEncrypt) getAccountInfoFilename() string {
+	return filepath.Join(l.dir, "account", "account"+l.suffix+".json")
+}
+
+func (l *LetsEncrypt) loadAccountInfo() (*accountInfo, error) {
+	b, err := ioutil.ReadFile(l.getAccountInfoFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &accountInfo{}, nil
+		}
+		return nil, err
+	}
+
+	rv := &accountInfo{}
+	if err := json.Unmarshal(b, rv); err != nil {
+		return nil, fmt.Errorf("letsencrypt: failed to parse account info: %s: %w", l.getAccountInfoFilename(), err)
+	}
+	return rv, nil
+}
+
+func (l *LetsEncrypt) writeAccountInfo(info *accountInfo) error {
+	b, err := json.MarshalIndent(info, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFile(l.getAccountInfoFilename(), append(b, '\n'), true)
+}
+
+func (l *LetsEncrypt) updateAccount(ctx context.Context, client *acme.Client, account *Account) error {
+	info, err := l.loadAccountInfo()
+	if err != nil {
+		return err
+	}
+	if account.EABKeyID != "" && account.EABKeyID != info.EABKeyID {
+		log.Printf("WARNING: account already registered, ignoring external account binding key id: %s", account.EABKeyID)
+	}
+
+	changed := false
+	if info.URI == "" {
+		// accounts registered by older versions have no info stored
+		log.Printf("retrieving account info ...")
+		a, err := client.GetReg(ctx, "")
+		if err != nil {
+			return err
+		}
+		info.URI = a.URI
+		info.Contact = a.Contact
+		changed = true
+	}
+
+	contact := account.getContact()
+	if !contactEqual(contact, info.Contact) {
+		if len(contact) == 0 {
+			log.Printf("WARNING: account contacts can't be removed, keeping current: %q", info.Contact)
+		} else {
+			log.Printf("updating account contacts: %q", contact)
+			a, err := client.UpdateReg(ctx, &acme.Account{
+				URI:     info.URI,
+				Contact: contact,
+			})
+			if err != nil {
+				return err
+			}
+			info.Contact = a.Contact
+			changed = true
+		}
+	}
+
+	if changed {
+		return l.writeAccountInfo(info)
+	}
+	return nil
+}
+
+func (l *LetsEncrypt) getClient(ctx context.Context) (*acme.Client, error) {
+	accountDir := filepath.Join(l.dir, "account")
+	if err := os.MkdirAll(accountDir, 0700); err != nil {
+		return nil, err
+	}
+
+	account := l.account
+	if account == nil {
+		account = &Account{}
+	}
+
+	keyFile := filepath.Join(accountDir, l.getPemFilename("key"))
+	if _, err := os.Stat(keyFile); err == nil {
+		log.Printf("loading account: %s", keyFile)
+
+		pk, err := loadPrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		client := &acme.Client{
+			Key:          pk,
+			DirectoryURL: l.directory,
+		}
+		if err := l.updateAccount(ctx, client, account); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	log.Printf("registering account: %s", keyFile)
+
+	pk, err := createPrivateKey(keyFile, KeyTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{
+		Key:          pk,
+		DirectoryURL: l.directory,
+	}
+
+	acct := &acme.Account{
+		Contact: account.getContact(),
+	}
+	info := &accountInfo{}
+	if account.EABKeyID != "" {
+		log.Printf("using external account binding key id: %s", account.EABKeyID)
+		acct.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: account.EABKeyID,
+			Key: account.EABHMACKey,
+		}
+		info.EABKeyID = account.EABKeyID
+	} else {
+		dir, err := client.Discover(ctx)
+		if err != nil {
+			os.Remove(keyFile)
+			return nil, err
+		}
+		if dir.ExternalAccountRequired {
+			os.Remove(keyFile)
+			return nil, errors.New("letsencrypt: acme directory requires external account binding")
+		}
+	}
+
+	a, err := client.Register(ctx, acct, acme.AcceptTOS)
+	if err == acme.ErrAccountAlreadyExists {
+		a, err = client.GetReg(ctx, "")
+	}
+	if err != nil {
+		// do not leave an unregistered key behind, otherwise it would be
+		// loaded as a valid account in the next run.
+		os.Remove(keyFile)
+		return nil, err
+	}
+	info.URI = a.URI
+	info.Contact = a.Contact
+
+	if err := l.writeAccountInfo(info); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (l *LetsEncrypt) RolloverAccountKey(ctx context.Context) error {
+	if l.client == nil {
+		return errors.New("letsencrypt: acme client not defined")
+	}
+
+	keyFile := filepath.Join(l.dir, "account", l.getPemFilename("key"))
+	newKeyFile := keyFile + ".new"
+	// a leftover new key may be the only copy of the active account key, if a
+	// previous rollover succeeded but failed to replace the key file.
+	if _, err := os.Lstat(newKeyFile); err == nil {
+		return fmt.Errorf("letsencrypt: %s exists, possibly from a failed rollover. please check which key is active for the account and remove or rename it manually", newKeyFile)
+	}
+
+	log.Printf("generating new account key: %s", newKeyFile)
+	pk, err := createPrivateKey(newKeyFile, KeyTypeDefault)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("rolling over account key ...")
+	if err := l.client.AccountKeyRollover(ctx, pk); err != nil {
+		os.Remove(newKeyFile)
+		return err
+	}
+
+	if err := os.Rename(newKeyFile, keyFile); err != nil {
+		return fmt.Errorf("letsencrypt: account key rolled over, but failed to replace %s with %s, please replace it manually: %w", keyFile, newKeyFile, err)
+	}
+	if err := syncDir(filepath.Dir(keyFile)); err != nil {
+		return err
+	}
+
+	log.Printf("account key rolled over: %s", keyFile)
+	return nil
+}
+
+func (l *LetsEncrypt) DeactivateAccount(ctx context.Context) error {
+	if l.client == nil {
+		return errors.New("letsencrypt: acme client not defined")
+	}
+
+	log.Printf("deactivating account ...")
+	if err := l.client.DeactivateReg(ctx); err != nil {
+		return err
+	}
+
+	// keep the files around for reference, but out of the way, so that
+	// the next run registers a new account.
+	ts := time.Now().UTC().Format(timestampLayout)
+	accountDir := filepath.Join(l.dir, "account")
+	keyFile := filepath.Join(accountDir, l.getPemFilename("key"))
+	if err := os.Rename(keyFile, filepath.Join(accountDir, l.getPemFilename("key-deactivated-"+ts))); err != nil {
+		return err
+	}
+	infoFile := l.getAccountInfoFilename()
+	if _, err := os.Stat(infoFile); err == nil {
+		if err := os.Rename(infoFile, filepath.Join(accountDir, "account-deactivated-"+ts+l.suffix+".json")); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("account deactivated: %s", keyFile)
+	return nil
+}
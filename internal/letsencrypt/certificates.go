@@ -1,45 +1,127 @@
 package letsencrypt
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/rafaelmartins/ledns/internal/dns"
 )
 
-func createCertificateRequest(pk *ecdsa.PrivateKey, names []string) ([]byte, error) {
+const renewBeforeDefault = 30 * 24 * time.Hour
+
+type Certificate struct {
+	Names        []string
+	KeyType      KeyType
+	DualKeyType  KeyType
+	ReuseKey     bool
+	KeepVersions int
+	KeepDays     int
+
+	// renewal window. certificates are renewed when expiring within it.
+	RenewBefore time.Duration
+
+	// per-certificate update command and dns provider, overriding the
+	// global ones, if defined.
+	UpdateCommand []string
+	DNS           dns.DNS
+
+	Export             []ExportFormat
+	ExportPasswordEnv  string
+	ExportPasswordFile string
+
+	Deploy []*Deploy
+}
+
+type certificateVariant struct {
+	name    string
+	keyType KeyType
+	cert    *Certificate
+	files   []*certificateFile
+}
+
+func (c *Certificate) getVariants() []*certificateVariant {
+	keyType := c.KeyType
+	if keyType == "" {
+		keyType = KeyTypeDefault
+	}
+
+	files := append([]*certificateFile{}, certificateFiles...)
+	for _, format := range c.Export {
+		files = append(files, exportFiles[format]...)
+	}
+
+	rv := []*certificateVariant{
+		{
+			keyType: keyType,
+			cert:    c,
+			files:   files,
+		},
+	}
+	if c.DualKeyType != "" {
+		rv = append(rv, &certificateVariant{
+			name:    c.DualKeyType.GetFamily(),
+			keyType: c.DualKeyType,
+			cert:    c,
+			files:   files,
+		})
+	}
+	return rv
+}
+
+func (v *certificateVariant) getName(name string) string {
+	if v.name == "" {
+		return name
+	}
+	return name + "-" + v.name
+}
+
+func createCertificateRequest(pk crypto.Signer, names []string) ([]byte, error) {
 	return x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
 		DNSNames: names,
 	}, pk)
 }
 
-func writeCertificate(certfile string, chain [][]byte) error {
-	if err := os.MkdirAll(filepath.Dir(certfile), 0700); err != nil {
-		return err
+func encodeCertificates(chain [][]byte) []byte {
+	rv := []byte{}
+	for _, p := range chain {
+		rv = append(rv, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p})...)
 	}
+	return rv
+}
 
-	fp, err := os.OpenFile(certfile, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
-	if err != nil {
-		return err
-	}
-	defer fp.Close()
+func writeCertificate(certfile string, chain [][]byte) error {
+	return writeFile(certfile, encodeCertificates(chain), false)
+}
 
-	for _, p := range chain {
-		if err := pem.Encode(fp, &pem.Block{Type: "CERTIFICATE", Bytes: p}); err != nil {
-			return err
-		}
+func certificateMatchesKey(chain [][]byte, pub crypto.PublicKey) bool {
+	if len(chain) == 0 {
+		return false
+	}
+	crt, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return false
 	}
-	return nil
+	k, ok := crt.PublicKey.(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	return ok && k.Equal(pub)
 }
 
-func needsNewCertificate(certfile string, names []string) (bool, time.Time, []string, []string) {
+func loadCertificateChain(certfile string) ([][]byte, error) {
 	b, err := ioutil.ReadFile(certfile)
 	if err != nil {
-		return true, time.Time{}, nil, nil
+		return nil, err
 	}
 
 	chain := [][]byte{}
@@ -49,21 +131,73 @@ func needsNewCertificate(certfile string, names []string) (bool, time.Time, []st
 		if p == nil {
 			break
 		}
-		chain = append(chain, p.Bytes)
+		if p.Type == "CERTIFICATE" {
+			chain = append(chain, p.Bytes)
+		}
 	}
 	if len(chain) == 0 {
-		return true, time.Time{}, nil, nil
+		return nil, fmt.Errorf("letsencrypt: no certificate found: %s", certfile)
+	}
+	return chain, nil
+}
+
+func getRevokedFilename(certfile string) string {
+	if p, err := filepath.EvalSymlinks(certfile); err == nil {
+		certfile = p
+	}
+	return certfile + ".revoked"
+}
+
+func isCertificateRevoked(certfile string) bool {
+	_, err := os.Stat(getRevokedFilename(certfile))
+	return err == nil
+}
+
+func getKeyType(pub crypto.PublicKey) KeyType {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch k.N.BitLen() {
+		case 2048:
+			return KeyTypeRSA2048
+		case 3072:
+			return KeyTypeRSA3072
+		case 4096:
+			return KeyTypeRSA4096
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyTypeP256
+		case elliptic.P384():
+			return KeyTypeP384
+		}
+	case ed25519.PublicKey:
+		return KeyTypeEd25519
+	}
+	return ""
+}
+
+func needsNewCertificate(certfile string, names []string, keyType KeyType, renewBefore time.Duration) (bool, time.Time, string) {
+	if isCertificateRevoked(certfile) {
+		return true, time.Time{}, "current certificate was revoked"
+	}
+
+	chain, err := loadCertificateChain(certfile)
+	if err != nil {
+		return true, time.Time{}, "could not find a suitable certificate"
 	}
 
 	crt, err := x509.ParseCertificate(chain[0])
 	if err != nil {
-		return true, time.Time{}, nil, nil
+		return true, time.Time{}, "could not find a suitable certificate"
 	}
 
 	// check if expired
-	duration := time.Until(crt.NotAfter)
-	if duration < 30*24*time.Hour {
-		return true, crt.NotAfter, nil, nil
+	if renewBefore == 0 {
+		renewBefore = renewBeforeDefault
+	}
+	if time.Until(crt.NotAfter) < renewBefore {
+		return true, crt.NotAfter, "current certificate expires " + crt.NotAfter.Format(time.UnixDate)
 	}
 
 	// check if names changed
@@ -94,8 +228,13 @@ func needsNewCertificate(certfile string, names []string) (bool, time.Time, []st
 		}
 	}
 	if len(added) > 0 || len(removed) > 0 {
-		return true, time.Time{}, added, removed
+		return true, crt.NotAfter, fmt.Sprintf("names changed from current certificate (added %q, removed %q)", added, removed)
+	}
+
+	// check if key type changed
+	if kt := getKeyType(crt.PublicKey); kt != keyType {
+		return true, crt.NotAfter, fmt.Sprintf("key type changed from current certificate (%q != %q)", kt, keyType)
 	}
 
-	return false, crt.NotAfter, nil, nil
+	return false, crt.NotAfter, ""
 }
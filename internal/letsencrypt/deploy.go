@@ -0,0 +1,281 @@
+package letsencrypt
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Deploy struct {
+	Dir   string
+	Files []string
+	UID   int
+	GID   int
+	Mode  os.FileMode
+}
+
+// value format: DIR[:FILES[:OWNER[:GROUP[:MODE]]]], where FILES is a comma
+// separated list of file names, as found in the certificate directory, but
+// without the acme directory suffix (e.g. fullchain.pem,privkey.pem).
+func ParseDeploy(value string) (*Deploy, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 5 {
+		return nil, fmt.Errorf("letsencrypt: invalid deploy: %s", value)
+	}
+	for len(parts) < 5 {
+		parts = append(parts, "")
+	}
+
+	if parts[0] == "" || !filepath.IsAbs(parts[0]) {
+		return nil, fmt.Errorf("letsencrypt: deploy directory must be an absolute path: %s", parts[0])
+	}
+
+	rv := &Deploy{
+		Dir:  filepath.Clean(parts[0]),
+		UID:  -1,
+		GID:  -1,
+		Mode: 0600,
+	}
+
+	for _, f := range strings.Split(parts[1], ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if f != filepath.Base(f) {
+			return nil, fmt.Errorf("letsencrypt: invalid deploy file name: %s", f)
+		}
+		rv.Files = append(rv.Files, f)
+	}
+
+	if parts[2] != "" {
+		if uid, err := strconv.Atoi(parts[2]); err == nil {
+			rv.UID = uid
+		} else {
+			u, err := user.Lookup(parts[2])
+			if err != nil {
+				return nil, err
+			}
+			rv.UID, err = strconv.Atoi(u.Uid)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if parts[3] != "" {
+		if gid, err := strconv.Atoi(parts[3]); err == nil {
+			rv.GID = gid
+		} else {
+			g, err := user.LookupGroup(parts[3])
+			if err != nil {
+				return nil, err
+			}
+			rv.GID, err = strconv.Atoi(g.Gid)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if parts[4] != "" {
+		mode, err := strconv.ParseUint(parts[4], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("letsencrypt: invalid deploy mode: %s", parts[4])
+		}
+		rv.Mode = os.FileMode(mode) & os.ModePerm
+	}
+
+	return rv, nil
+}
+
+// files are read from the current version directory, instead of the stable
+// symlinks, so that all of them belong to the same version.
+func (l *LetsEncrypt) getDeployFiles(cert *Certificate) (map[string]string, error) {
+	commonName := cert.Names[0]
+
+	rv := map[string]string{}
+	for _, variant := range cert.getVariants() {
+		ts, err := l.getCurrentVersion(commonName, variant)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range variant.files {
+			rv[variant.getName(file.name)+file.ext] = l.getVersionFilename(commonName, variant, file, ts)
+		}
+	}
+	return rv, nil
+}
+
+const deployCurrent = ".ledns-current"
+
+// directories must be accessible by whoever can read the files
+func (d *Deploy) getDirMode() os.FileMode {
+	return d.Mode | (d.Mode&0444)>>2
+}
+
+// mkdirAll creates the destination directory and its missing parents with
+// the owner, group and mode of the deployed files.
+func (d *Deploy) mkdirAll() error {
+	created := []string{}
+	for dir := d.Dir; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			break
+		}
+		created = append(created, dir)
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(d.Dir, 0700); err != nil {
+		return err
+	}
+	for _, dir := range created {
+		if err := os.Chmod(dir, d.getDirMode()); err != nil {
+			return err
+		}
+		if d.UID != -1 || d.GID != -1 {
+			if err := os.Chown(dir, d.UID, d.GID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// files are written to a new hidden directory in the destination, that
+// replaces the previous one by switching a single symlink. the destination
+// file names are symlinks through it, so consumers always see files from the
+// same version, and failed deploys leave the previous one untouched.
+func (l *LetsEncrypt) deploy(commonName string, d *Deploy, files []string, data map[string][]byte) error {
+	if err := d.mkdirAll(); err != nil {
+		return err
+	}
+
+	vdir, err := ioutil.TempDir(d.Dir, ".ledns-")
+	if err != nil {
+		return err
+	}
+	fail := func(e error) error {
+		os.RemoveAll(vdir)
+		return e
+	}
+
+	for _, f := range files {
+		if err := installFile(filepath.Join(vdir, f), data[f], d.Mode, d.UID, d.GID); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := os.Chmod(vdir, d.getDirMode()); err != nil {
+		return fail(err)
+	}
+	if d.UID != -1 || d.GID != -1 {
+		if err := os.Chown(vdir, d.UID, d.GID); err != nil {
+			return fail(err)
+		}
+	}
+
+	current := filepath.Join(d.Dir, deployCurrent)
+	old, _ := os.Readlink(current)
+	if err := symlink(filepath.Base(vdir), current); err != nil {
+		return fail(err)
+	}
+
+	for _, f := range files {
+		dst := filepath.Join(d.Dir, f)
+		log.Printf("[%s] deploying: %s", commonName, dst)
+		target := filepath.Join(deployCurrent, f)
+		if t, err := os.Readlink(dst); err == nil && t == target {
+			continue
+		}
+		if err := symlink(target, dst); err != nil {
+			return err
+		}
+	}
+
+	// remove symlinks to files that are not deployed anymore
+	entries, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return err
+	}
+	for _, st := range entries {
+		if _, found := data[st.Name()]; found || st.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if t, err := os.Readlink(filepath.Join(d.Dir, st.Name())); err == nil && filepath.Dir(t) == deployCurrent {
+			os.Remove(filepath.Join(d.Dir, st.Name()))
+		}
+	}
+
+	if old != "" && old == filepath.Base(old) && strings.HasPrefix(old, ".ledns-") {
+		return os.RemoveAll(filepath.Join(d.Dir, old))
+	}
+	return nil
+}
+
+// IsIssued returns true if all the variants of a certificate have a current
+// version.
+func (l *LetsEncrypt) IsIssued(cert *Certificate) bool {
+	if cert == nil || len(cert.Names) == 0 {
+		return false
+	}
+	for _, variant := range cert.getVariants() {
+		if _, err := os.Lstat(l.getCurrentSymlinkFilename(cert.Names[0], variant)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *LetsEncrypt) Deploy(cert *Certificate) error {
+	if cert == nil || len(cert.Names) == 0 {
+		return errors.New("letsencrypt: no name provided")
+	}
+	if len(cert.Deploy) == 0 {
+		return nil
+	}
+	commonName := cert.Names[0]
+
+	available, err := l.getDeployFiles(cert)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range cert.Deploy {
+		files := d.Files
+		if len(files) == 0 {
+			for f := range available {
+				files = append(files, f)
+			}
+			sort.Strings(files)
+		}
+
+		// read everything before installing anything
+		data := map[string][]byte{}
+		for _, f := range files {
+			src, found := available[f]
+			if !found {
+				return fmt.Errorf("letsencrypt: [%s] invalid deploy file: %s", commonName, f)
+			}
+			b, err := ioutil.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			data[f] = b
+		}
+
+		if err := l.deploy(commonName, d, files, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package letsencrypt
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type ExportFormat string
+
+const (
+	ExportDER    ExportFormat = "der"
+	ExportPKCS12 ExportFormat = "p12"
+)
+
+var exportFiles = map[ExportFormat][]*certificateFile{
+	ExportDER: {
+		{"cert", ".der"},
+		{"privkey", ".der"},
+	},
+	ExportPKCS12: {
+		{"bundle", ".p12"},
+	},
+}
+
+func ParseExportFormat(format string) (ExportFormat, error) {
+	switch strings.ToLower(format) {
+	case "der":
+		return ExportDER, nil
+	case "p12", "pfx", "pkcs12":
+		return ExportPKCS12, nil
+	}
+	return "", fmt.Errorf("letsencrypt: invalid export format: %s", format)
+}
+
+func allCertificateFiles() []*certificateFile {
+	rv := append([]*certificateFile{}, certificateFiles...)
+	for _, files := range exportFiles {
+		rv = append(rv, files...)
+	}
+	return rv
+}
+
+func (c *Certificate) getExportPassword() (string, error) {
+	if c.ExportPasswordEnv != "" {
+		v, found := os.LookupEnv(c.ExportPasswordEnv)
+		if !found {
+			return "", fmt.Errorf("letsencrypt: export password environment variable not defined: %s", c.ExportPasswordEnv)
+		}
+		return v, nil
+	}
+	if c.ExportPasswordFile != "" {
+		b, err := ioutil.ReadFile(c.ExportPasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return "", nil
+}
+
+func (l *LetsEncrypt) encodeExport(variant *certificateVariant, file *certificateFile, key *pem.Block, chain [][]byte) ([]byte, error) {
+	switch *file {
+	case certificateFile{"cert", ".der"}:
+		return chain[0], nil
+
+	case certificateFile{"privkey", ".der"}:
+		pk, err := parsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return x509.MarshalPKCS8PrivateKey(pk)
+
+	case certificateFile{"bundle", ".p12"}:
+		pk, err := parsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		crts := []*x509.Certificate{}
+		for _, c := range chain {
+			crt, err := x509.ParseCertificate(c)
+			if err != nil {
+				return nil, err
+			}
+			crts = append(crts, crt)
+		}
+		password, err := variant.cert.getExportPassword()
+		if err != nil {
+			return nil, err
+		}
+		return pkcs12.Encode(rand.Reader, pk, crts[0], crts[1:], password)
+	}
+
+	return nil, nil
+}
+
+// updateExports regenerates the PKCS#12 bundle of the current version if the
+// export password changed, and removes the symlinks of export formats that
+// are not enabled anymore. returns true if any current file changed.
+func (l *LetsEncrypt) updateExports(commonName string, variant *certificateVariant) (bool, error) {
+	ts, err := l.getCurrentVersion(commonName, variant)
+	if err != nil {
+		return false, nil
+	}
+
+	changed := false
+	bundle := certificateFile{"bundle", ".p12"}
+	for _, file := range variant.files {
+		if *file != bundle {
+			continue
+		}
+
+		fpath := l.getVersionFilename(commonName, variant, file, ts)
+		data, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return false, err
+		}
+		password, err := variant.cert.getExportPassword()
+		if err != nil {
+			return false, err
+		}
+		if _, _, _, err := pkcs12.DecodeChain(data, password); err == nil {
+			continue
+		}
+
+		log.Printf("[%s] export password changed, regenerating: %s", commonName, fpath)
+		key, err := readPrivateKey(l.getVersionFilename(commonName, variant, filePrivkey, ts))
+		if err != nil {
+			return false, err
+		}
+		chain, err := loadCertificateChain(l.getVersionFilename(commonName, variant, fileFullchain, ts))
+		if err != nil {
+			return false, err
+		}
+		data, err = l.encodeExport(variant, file, key, chain)
+		if err != nil {
+			return false, err
+		}
+		if err := writeFile(fpath, data, true); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	// files of disabled formats are kept in the version directories, and
+	// removed with them.
+	for _, file := range allCertificateFiles() {
+		enabled := false
+		for _, f := range variant.files {
+			if *f == *file {
+				enabled = true
+				break
+			}
+		}
+		if enabled {
+			continue
+		}
+
+		fpath := l.getSymlinkFilename(commonName, variant, file)
+		if target, err := os.Readlink(fpath); err == nil && target == l.getSymlinkTarget(variant, file) {
+			log.Printf("[%s] export disabled, removing symlink: %s", commonName, fpath)
+			if err := os.Remove(fpath); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
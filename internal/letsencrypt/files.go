@@ -0,0 +1,108 @@
+package letsencrypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func syncDir(dir string) error {
+	fp, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return fp.Sync()
+}
+
+func writeTempFile(fpath string, data []byte, mode os.FileMode, uid int, gid int) (string, error) {
+	dir := filepath.Dir(fpath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	fp, err := ioutil.TempFile(dir, "."+filepath.Base(fpath)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	tmp := fp.Name()
+
+	fail := func(e error) (string, error) {
+		fp.Close()
+		os.Remove(tmp)
+		return "", e
+	}
+
+	if _, err := fp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := fp.Chmod(mode); err != nil {
+		return fail(err)
+	}
+	if uid != -1 || gid != -1 {
+		if err := fp.Chown(uid, gid); err != nil {
+			return fail(err)
+		}
+	}
+	if err := fp.Sync(); err != nil {
+		return fail(err)
+	}
+
+	if err := fp.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// data is written to a synced temporary file that is moved into place, so
+// readers never see a partially written file.
+func writeFile(fpath string, data []byte, overwrite bool) error {
+	tmp, err := writeTempFile(fpath, data, 0600, -1, -1)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if overwrite {
+		err = os.Rename(tmp, fpath)
+	} else {
+		// link(2) fails if the destination exists, unlike rename(2)
+		err = os.Link(tmp, fpath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(fpath))
+}
+
+func installFile(fpath string, data []byte, mode os.FileMode, uid int, gid int) error {
+	tmp, err := writeTempFile(fpath, data, mode, uid, gid)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, fpath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(fpath))
+}
+
+func symlink(target string, fpath string) error {
+	dir := filepath.Dir(fpath)
+	tmp := filepath.Join(dir, "."+filepath.Base(fpath)+".tmp"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fpath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("letsencrypt: failed to update symlink: %w", err)
+	}
+	return syncDir(dir)
+}
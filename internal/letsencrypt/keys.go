@@ -1,46 +1,124 @@
 package letsencrypt
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"strings"
 )
 
-func createPrivateKey(keyfile string) (*ecdsa.PrivateKey, error) {
-	pk, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-	if err != nil {
-		return nil, err
+type KeyType string
+
+const (
+	KeyTypeRSA2048 KeyType = "rsa2048"
+	KeyTypeRSA3072 KeyType = "rsa3072"
+	KeyTypeRSA4096 KeyType = "rsa4096"
+	KeyTypeP256    KeyType = "p256"
+	KeyTypeP384    KeyType = "p384"
+	KeyTypeEd25519 KeyType = "ed25519"
+
+	KeyTypeDefault = KeyTypeP384
+)
+
+var keyTypes = []KeyType{
+	KeyTypeRSA2048,
+	KeyTypeRSA3072,
+	KeyTypeRSA4096,
+	KeyTypeP256,
+	KeyTypeP384,
+	KeyTypeEd25519,
+}
+
+func ParseKeyType(keyType string) (KeyType, error) {
+	for _, kt := range keyTypes {
+		if strings.EqualFold(string(kt), keyType) {
+			return kt, nil
+		}
 	}
+	return "", fmt.Errorf("letsencrypt: invalid key type: %s", keyType)
+}
 
-	p, err := x509.MarshalECPrivateKey(pk)
-	if err != nil {
-		return nil, err
+func (k KeyType) GetFamily() string {
+	switch k {
+	case KeyTypeRSA2048, KeyTypeRSA3072, KeyTypeRSA4096:
+		return "rsa"
+	case KeyTypeP256, KeyTypeP384:
+		return "ecdsa"
 	}
+	return string(k)
+}
 
-	if err := os.MkdirAll(filepath.Dir(keyfile), 0700); err != nil {
-		return nil, err
+func generatePrivateKey(keyType KeyType) (crypto.Signer, *pem.Block, error) {
+	switch keyType {
+	case KeyTypeRSA2048, KeyTypeRSA3072, KeyTypeRSA4096:
+		bits := 2048
+		if keyType == KeyTypeRSA3072 {
+			bits = 3072
+		} else if keyType == KeyTypeRSA4096 {
+			bits = 4096
+		}
+		pk, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pk, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)}, nil
+
+	case KeyTypeP256, KeyTypeP384:
+		curve := elliptic.P384()
+		if keyType == KeyTypeP256 {
+			curve = elliptic.P256()
+		}
+		pk, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := x509.MarshalECPrivateKey(pk)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pk, &pem.Block{Type: "EC PRIVATE KEY", Bytes: p}, nil
+
+	case KeyTypeEd25519:
+		_, pk, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := x509.MarshalPKCS8PrivateKey(pk)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pk, &pem.Block{Type: "PRIVATE KEY", Bytes: p}, nil
 	}
 
-	fp, err := os.OpenFile(keyfile, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	return nil, nil, fmt.Errorf("letsencrypt: invalid key type: %s", keyType)
+}
+
+func writePrivateKey(keyfile string, p *pem.Block) error {
+	return writeFile(keyfile, pem.EncodeToMemory(p), false)
+}
+
+func createPrivateKey(keyfile string, keyType KeyType) (crypto.Signer, error) {
+	pk, p, err := generatePrivateKey(keyType)
 	if err != nil {
 		return nil, err
 	}
-	defer fp.Close()
 
-	if err := pem.Encode(fp, &pem.Block{Type: "EC PRIVATE KEY", Bytes: p}); err != nil {
+	if err := writePrivateKey(keyfile, p); err != nil {
 		return nil, err
 	}
 
 	return pk, nil
 }
 
-func loadPrivateKey(keyfile string) (*ecdsa.PrivateKey, error) {
+func readPrivateKey(keyfile string) (*pem.Block, error) {
 	fp, err := os.Open(keyfile)
 	if err != nil {
 		return nil, err
@@ -56,6 +134,59 @@ func loadPrivateKey(keyfile string) (*ecdsa.PrivateKey, error) {
 	if p == nil {
 		return nil, fmt.Errorf("letsencrypt: failed to parse private key: %s", keyfile)
 	}
+	return p, nil
+}
+
+func parsePrivateKey(p *pem.Block) (crypto.Signer, error) {
+	switch p.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(p.Bytes)
+
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(p.Bytes)
+
+	case "PRIVATE KEY":
+		pk, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := pk.(crypto.Signer); ok {
+			return s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("letsencrypt: unsupported private key: %s", p.Type)
+}
+
+func loadPrivateKey(keyfile string) (crypto.Signer, error) {
+	p, err := readPrivateKey(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := parsePrivateKey(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, keyfile)
+	}
+	return pk, nil
+}
+
+func reusePrivateKey(keyfile string, oldKeyfile string, keyType KeyType) (crypto.Signer, error) {
+	p, err := readPrivateKey(oldKeyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := parsePrivateKey(p)
+	if err != nil {
+		return nil, err
+	}
+	if kt := getKeyType(pk.Public()); kt != keyType {
+		return nil, fmt.Errorf("letsencrypt: private key type does not match (%q != %q): %s", kt, keyType, oldKeyfile)
+	}
 
-	return x509.ParseECPrivateKey(p.Bytes)
+	if err := writePrivateKey(keyfile, p); err != nil {
+		return nil, err
+	}
+	return pk, nil
 }
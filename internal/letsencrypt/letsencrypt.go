@@ -2,12 +2,15 @@ package letsencrypt
 
 import (
 	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/rafaelmartins/ledns/internal/dns"
@@ -15,83 +18,78 @@ import (
 )
 
 const (
-	urlStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
-	urlProduction = "https://acme-v02.api.letsencrypt.org/directory"
+	DirectoryStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	DirectoryProduction = "https://acme-v02.api.letsencrypt.org/directory"
 )
 
 type LetsEncrypt struct {
-	dir        string
-	production bool
-	dns        dns.DNS
-	client     *acme.Client
+	dir       string
+	directory string
+	suffix    string
+	account   *Account
+	dns       dns.DNS
+	client    *acme.Client
 }
 
-func NewLetsEncrypt(ctx context.Context, dir string, production bool, dns dns.DNS) (*LetsEncrypt, error) {
-	rv := &LetsEncrypt{
-		dir:        dir,
-		production: production,
-		dns:        dns,
-	}
-
-	client, err := rv.getClient(ctx)
+func NewLetsEncrypt(dir string, directory string, account *Account, dns dns.DNS) (*LetsEncrypt, error) {
+	suffix, err := getDirectorySuffix(directory)
 	if err != nil {
 		return nil, err
 	}
-	rv.client = client
 
-	return rv, nil
+	return &LetsEncrypt{
+		dir:       dir,
+		directory: directory,
+		suffix:    suffix,
+		account:   account,
+		dns:       dns,
+	}, nil
 }
 
-func (l *LetsEncrypt) getPemFilename(name string) string {
-	if l.production {
-		return name + ".pem"
+// InitClient loads or registers the account, and must be called before any
+// operation that talks to the acme server. local operations, like pruning and
+// deploying certificates, work without it.
+func (l *LetsEncrypt) InitClient(ctx context.Context) error {
+	client, err := l.getClient(ctx)
+	if err != nil {
+		return err
 	}
-	return name + "-staging.pem"
+	l.client = client
+	return nil
 }
 
-func (l *LetsEncrypt) getUrl() string {
-	if l.production {
-		return urlProduction
+func getDirectorySuffix(directory string) (string, error) {
+	// let's encrypt keeps the historical file names, other CAs get a suffix
+	// derived from the directory url, to avoid collisions in the data dir.
+	switch directory {
+	case DirectoryProduction:
+		return "", nil
+	case DirectoryStaging:
+		return "-staging", nil
 	}
-	return urlStaging
-}
 
-func (l *LetsEncrypt) getClient(ctx context.Context) (*acme.Client, error) {
-	accountDir := filepath.Join(l.dir, "account")
-	if err := os.MkdirAll(accountDir, 0700); err != nil {
-		return nil, err
+	u, err := url.Parse(directory)
+	if err != nil {
+		return "", err
 	}
-
-	keyFile := filepath.Join(accountDir, l.getPemFilename("key"))
-	if _, err := os.Stat(keyFile); err == nil {
-		log.Printf("loading account: %s", keyFile)
-
-		pk, err := loadPrivateKey(keyFile)
-		if err != nil {
-			return nil, err
-		}
-
-		return &acme.Client{
-			Key:          pk,
-			DirectoryURL: l.getUrl(),
-		}, nil
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", fmt.Errorf("letsencrypt: invalid acme directory url: %s", directory)
 	}
 
-	log.Printf("registering account: %s", keyFile)
+	return "-" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(u.Host+u.Path, "/")), nil
+}
 
-	pk, err := createPrivateKey(keyFile)
-	if err != nil {
-		return nil, err
-	}
+func (l *LetsEncrypt) getFilename(name string, ext string) string {
+	return name + l.suffix + ext
+}
 
-	client := &acme.Client{
-		Key:          pk,
-		DirectoryURL: l.getUrl(),
-	}
-	if _, err := client.Register(ctx, &acme.Account{}, acme.AcceptTOS); err != nil {
-		return nil, err
-	}
-	return client, nil
+func (l *LetsEncrypt) getPemFilename(name string) string {
+	return l.getFilename(name, ".pem")
 }
 
 func (l *LetsEncrypt) cleanupAuthorizations(ctx context.Context, commonName string, urls []string) {
@@ -103,54 +101,25 @@ func (l *LetsEncrypt) cleanupAuthorizations(ctx context.Context, commonName stri
 	}
 }
 
-func (l *LetsEncrypt) GetCertificate(ctx context.Context, names []string, force bool) (bool, error) {
-	if l.client == nil {
-		return false, errors.New("letsencrypt: acme client not defined")
-	}
-
-	if len(names) == 0 {
-		return false, errors.New("letsencrypt: no name provided")
-	}
-
-	commonName := names[0]
-
-	log.Printf("[%s] starting ...", commonName)
-
-	symCertfile := filepath.Join(l.dir, "certs", commonName, l.getPemFilename("fullchain"))
+func (l *LetsEncrypt) getCertFilename(commonName string, name string) string {
+	return filepath.Join(l.dir, "certs", commonName, l.getPemFilename(name))
+}
 
-	if force {
-		log.Printf("[%s] requesting new certificate (forced) ...", commonName)
-	} else {
-		log.Printf("[%s] checking if a new certificate is needed ...", commonName)
-		needsNew, expiration, added, removed := needsNewCertificate(symCertfile, names)
-		if !needsNew {
-			log.Printf("[%s] current certificate expires %s. skipping renew ...", commonName, expiration.Format(time.UnixDate))
-			return false, nil
-		}
-		if expiration.IsZero() {
-			if len(added) > 0 || len(removed) > 0 {
-				log.Printf("[%s] names changed from current certificate (added %q, removed %q). requesting new ...", commonName, added, removed)
-			} else {
-				log.Printf("[%s] could not find a suitable certificate. requesting new ...", commonName)
-			}
-		} else {
-			log.Printf("[%s] current certificate expires %s. renewing ...", commonName, expiration.Format(time.UnixDate))
-		}
+func (l *LetsEncrypt) getDNS(cert *Certificate) dns.DNS {
+	if cert.DNS != nil {
+		return cert.DNS
 	}
+	return l.dns
+}
 
-	order, err := l.client.AuthorizeOrder(ctx, acme.DomainIDs(names...))
-	if err != nil {
-		return false, err
-	}
-	defer l.cleanupAuthorizations(ctx, commonName, order.AuthzURLs)
-
+func (l *LetsEncrypt) authorize(ctx context.Context, commonName string, order *acme.Order, d dns.DNS) error {
 	chals := []*acme.Challenge{}
 	authTokens := map[string]string{}
 	authURIs := []string{}
 	for _, u := range order.AuthzURLs {
 		z, err := l.client.GetAuthorization(ctx, u)
 		if err != nil {
-			return false, err
+			return err
 		}
 
 		if z.Status != acme.StatusPending {
@@ -165,25 +134,25 @@ func (l *LetsEncrypt) GetCertificate(ctx context.Context, names []string, force
 			}
 		}
 		if chal == nil {
-			return false, fmt.Errorf("letsencrypt: %s: no dns-01 challenge found", z.Identifier.Value)
+			return fmt.Errorf("letsencrypt: %s: no dns-01 challenge found", z.Identifier.Value)
 		}
 
 		log.Printf("[%s: %s] generating challenge record ...", commonName, z.Identifier.Value)
 		token, err := l.client.DNS01ChallengeRecord(chal.Token)
 		if err != nil {
-			return false, err
+			return err
 		}
 
 		log.Printf("[%s: %s] deploying challenge ...", commonName, z.Identifier.Value)
-		if err := dns.DeployChallenge(ctx, l.dns, z.Identifier.Value, token); err != nil {
-			return false, err
+		if err := dns.DeployChallenge(ctx, d, z.Identifier.Value, token); err != nil {
+			return err
 		}
 		defer func(d dns.DNS, commonName string, name string, token string) {
 			log.Printf("[%s: %s] cleaning challenge ...", commonName, name)
 			if err := dns.CleanChallenge(d, name, token); err != nil {
 				log.Printf("error: [%s: %s] %s", commonName, name, err)
 			}
-		}(l.dns, commonName, z.Identifier.Value, token)
+		}(d, commonName, z.Identifier.Value, token)
 
 		chals = append(chals, chal)
 		authTokens[z.Identifier.Value] = token
@@ -193,8 +162,8 @@ func (l *LetsEncrypt) GetCertificate(ctx context.Context, names []string, force
 	if len(authTokens) > 0 {
 		log.Printf("[%s] waiting for DNS propagation of challenges ...", commonName)
 		for name, token := range authTokens {
-			if err := dns.WaitForChallenge(ctx, l.dns, name, token); err != nil {
-				return false, err
+			if err := dns.WaitForChallenge(ctx, d, name, token); err != nil {
+				return err
 			}
 		}
 	}
@@ -203,7 +172,7 @@ func (l *LetsEncrypt) GetCertificate(ctx context.Context, names []string, force
 		log.Printf("[%s] accepting challenges ...", commonName)
 		for _, chal := range chals {
 			if _, err := l.client.Accept(ctx, chal); err != nil {
-				return false, err
+				return err
 			}
 		}
 	}
@@ -212,69 +181,199 @@ func (l *LetsEncrypt) GetCertificate(ctx context.Context, names []string, force
 		log.Printf("[%s] waiting for autorizations ...", commonName)
 		for _, uri := range authURIs {
 			if _, err := l.client.WaitAuthorization(ctx, uri); err != nil {
-				return false, err
+				return err
 			}
 		}
 	}
 
-	ts := time.Now().UTC().Format("20060102150405")
+	return nil
+}
 
-	keyfile := filepath.Join(l.dir, "certs", commonName, l.getPemFilename("privkey-"+ts))
-	pk, err := createPrivateKey(keyfile)
-	if err != nil {
-		return false, err
+func (l *LetsEncrypt) issueCertificate(ctx context.Context, order *acme.Order, names []string, variant *certificateVariant, ts string, reuseKey bool) error {
+	commonName := names[0]
+
+	keyfile := l.getVersionFilename(commonName, variant, filePrivkey, ts)
+	certfile := l.getVersionFilename(commonName, variant, fileFullchain, ts)
+	symKeyfile := l.getSymlinkFilename(commonName, variant, filePrivkey)
+
+	var pk crypto.Signer
+	if _, err := os.Stat(symKeyfile); err == nil && reuseKey {
+		log.Printf("[%s] reusing current %s private key ...", commonName, variant.keyType)
+		k, err := reusePrivateKey(keyfile, symKeyfile, variant.keyType)
+		if err != nil {
+			log.Printf("[%s] failed to reuse private key, generating new: %s", commonName, err)
+		} else {
+			pk = k
+		}
+	}
+	if pk == nil {
+		k, err := createPrivateKey(keyfile, variant.keyType)
+		if err != nil {
+			return err
+		}
+		pk = k
 	}
 
+	// do not leave a private key without certificate behind
+	issued := false
+	defer func() {
+		if !issued {
+			os.Remove(keyfile)
+			os.Remove(filepath.Dir(keyfile))
+		}
+	}()
+
 	csr, err := createCertificateRequest(pk, names)
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	chain, _, err := l.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
 	if err != nil {
-		return false, err
+		return err
+	}
+
+	if !certificateMatchesKey(chain, pk.Public()) {
+		return fmt.Errorf("letsencrypt: [%s] issued certificate does not match private key", commonName)
 	}
 
-	certfile := filepath.Join(l.dir, "certs", commonName, l.getPemFilename("fullchain-"+ts))
 	if err := writeCertificate(certfile, chain); err != nil {
-		return false, err
+		return err
+	}
+	issued = true
+
+	if err := l.completeVersion(commonName, variant, ts); err != nil {
+		return err
 	}
 
 	log.Printf("[%s] updating symlinks ...", commonName)
+	return l.updateSymlinks(commonName, variant, ts)
+}
+
+func (l *LetsEncrypt) GetCertificate(ctx context.Context, cert *Certificate, force bool) (bool, error) {
+	return l.getCertificate(ctx, cert, force, false)
+}
 
-	// FIXME: make this symlink replacement actually atomic/safe
+func (l *LetsEncrypt) RotateKey(ctx context.Context, cert *Certificate) (bool, error) {
+	return l.getCertificate(ctx, cert, true, true)
+}
 
-	symKeyfile := filepath.Join(l.dir, "certs", commonName, l.getPemFilename("privkey"))
-	if _, err := os.Lstat(symKeyfile); err == nil {
-		os.Remove(symKeyfile)
+func (l *LetsEncrypt) getCertificate(ctx context.Context, cert *Certificate, force bool, rotateKey bool) (bool, error) {
+	if l.client == nil {
+		return false, errors.New("letsencrypt: acme client not defined")
 	}
-	if err := os.Symlink(l.getPemFilename("privkey-"+ts), symKeyfile); err != nil {
+
+	if cert == nil || len(cert.Names) == 0 {
+		return false, errors.New("letsencrypt: no name provided")
+	}
+
+	names := cert.Names
+	commonName := names[0]
+
+	log.Printf("[%s] starting ...", commonName)
+
+	// fail early, before issuing anything
+	if _, err := cert.getExportPassword(); err != nil {
 		return false, err
 	}
 
-	if _, err := os.Lstat(symCertfile); err == nil {
-		os.Remove(symCertfile)
+	// the current files change if exports were updated, even if no new
+	// certificate is issued.
+	changed := false
+	for _, variant := range cert.getVariants() {
+		if err := l.repairSymlinks(commonName, variant); err != nil {
+			return false, err
+		}
+		updated, err := l.updateExports(commonName, variant)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || updated
 	}
-	if err := os.Symlink(l.getPemFilename("fullchain-"+ts), symCertfile); err != nil {
-		return false, err
+
+	variants := []*certificateVariant{}
+	if rotateKey {
+		log.Printf("[%s] requesting new certificate with new private key ...", commonName)
+		variants = cert.getVariants()
+	} else if force {
+		log.Printf("[%s] requesting new certificate (forced) ...", commonName)
+		variants = cert.getVariants()
+	} else {
+		log.Printf("[%s] checking if a new certificate is needed ...", commonName)
+		for _, variant := range cert.getVariants() {
+			symCertfile := l.getCertFilename(commonName, variant.getName("fullchain"))
+			needsNew, expiration, reason := needsNewCertificate(symCertfile, names, variant.keyType, cert.RenewBefore)
+			if !needsNew {
+				log.Printf("[%s] current %s certificate expires %s. skipping renew ...", commonName, variant.keyType, expiration.Format(time.UnixDate))
+				continue
+			}
+			log.Printf("[%s] %s. requesting new %s certificate ...", commonName, reason, variant.keyType)
+			variants = append(variants, variant)
+		}
+		if len(variants) == 0 {
+			return changed, nil
+		}
+	}
+
+	order, err := l.client.AuthorizeOrder(ctx, acme.DomainIDs(names...))
+	if err != nil {
+		return changed, err
+	}
+	defer l.cleanupAuthorizations(ctx, commonName, order.AuthzURLs)
+
+	if err := l.authorize(ctx, commonName, order, l.getDNS(cert)); err != nil {
+		return changed, err
+	}
+
+	ts := time.Now().UTC().Format(timestampLayout)
+
+	// if a variant fails after others were switched, the caller must still
+	// deploy and run the update commands, as the current files changed.
+	for i, variant := range variants {
+		if i > 0 {
+			// authorizations validated for the first order are reused by the
+			// ca, so new orders for the same names are ready right away.
+			order, err = l.client.AuthorizeOrder(ctx, acme.DomainIDs(names...))
+			if err != nil {
+				return changed, err
+			}
+			if err := l.authorize(ctx, commonName, order, l.getDNS(cert)); err != nil {
+				return changed, err
+			}
+			if _, err := l.client.WaitOrder(ctx, order.URI); err != nil {
+				return changed, err
+			}
+		}
+
+		log.Printf("[%s] requesting %s certificate ...", commonName, variant.keyType)
+		if err := l.issueCertificate(ctx, order, names, variant, ts, cert.ReuseKey && !rotateKey); err != nil {
+			return changed, err
+		}
+		changed = true
 	}
 
 	log.Printf("[%s] certificate request done", commonName)
 	return true, nil
 }
 
-func (l *LetsEncrypt) RunCommand(names []string, command []string) error {
+func (l *LetsEncrypt) RunCommand(cert *Certificate, command []string) error {
 	if len(command) > 0 {
-		log.Printf("[%s] running update command %q ...", names[0], command)
+		commonName := cert.Names[0]
+		log.Printf("[%s] running update command %q ...", commonName, command)
 
 		cmd := exec.Command(command[0], command[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		cmd.Env = append(
 			os.Environ(),
-			"LEDNS_COMMON_NAME="+names[0],
-			"LEDNS_CERTIFICATE="+filepath.Join(l.dir, "certs", names[0], l.getPemFilename("fullchain")),
+			"LEDNS_COMMON_NAME="+commonName,
+			"LEDNS_CERTIFICATE="+l.getCertFilename(commonName, "fullchain"),
 		)
+		for _, variant := range cert.getVariants() {
+			if variant.name != "" {
+				cmd.Env = append(cmd.Env, "LEDNS_CERTIFICATE_"+strings.ToUpper(variant.name)+"="+l.getCertFilename(commonName, variant.getName("fullchain")))
+			}
+		}
 		return cmd.Run()
 	}
 	return nil
@@ -0,0 +1,95 @@
+package letsencrypt
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func (l *LetsEncrypt) getPrunableVersions(cert *Certificate, variant *certificateVariant) ([]string, error) {
+	commonName := cert.Names[0]
+
+	current, err := l.getCurrentVersion(commonName, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := l.getVersions(commonName, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := []string{}
+	i := 0
+	for _, ts := range versions {
+		// versions without certificate are not usable, and do not count
+		if ts != current && !l.hasCertificate(commonName, variant, ts) {
+			rv = append(rv, ts)
+			continue
+		}
+		i++
+		if ts == current {
+			continue
+		}
+		if cert.KeepVersions > 0 && i <= cert.KeepVersions {
+			continue
+		}
+		if cert.KeepDays > 0 {
+			t, err := time.Parse(timestampLayout, ts)
+			if err != nil {
+				return nil, err
+			}
+			if time.Since(t) < time.Duration(cert.KeepDays)*24*time.Hour {
+				continue
+			}
+		}
+		rv = append(rv, ts)
+	}
+	return rv, nil
+}
+
+func (l *LetsEncrypt) Prune(cert *Certificate, dryRun bool) error {
+	if cert == nil || len(cert.Names) == 0 {
+		return nil
+	}
+	commonName := cert.Names[0]
+
+	if cert.KeepVersions == 0 && cert.KeepDays == 0 {
+		return nil
+	}
+
+	for _, variant := range cert.getVariants() {
+		versions, err := l.getPrunableVersions(cert, variant)
+		if err != nil {
+			log.Printf("[%s] skipping prune, could not detect current version: %s", commonName, err)
+			continue
+		}
+
+		for _, ts := range versions {
+			files, err := l.getVersionFiles(commonName, variant, ts)
+			if err != nil {
+				return err
+			}
+
+			for _, fpath := range files {
+				if dryRun {
+					log.Printf("[%s] would remove: %s", commonName, fpath)
+				} else {
+					log.Printf("[%s] removing: %s", commonName, fpath)
+					if err := os.Remove(fpath); err != nil {
+						return err
+					}
+				}
+			}
+
+			// version directories are shared by all variants, and only go
+			// away when empty
+			if !dryRun {
+				os.Remove(filepath.Join(l.dir, "certs", commonName, l.getVersionDirname(ts)))
+			}
+		}
+	}
+
+	return nil
+}
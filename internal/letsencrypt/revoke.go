@@ -0,0 +1,153 @@
+package letsencrypt
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+var revocationReasons = map[string]acme.CRLReasonCode{
+	"unspecified":          acme.CRLReasonUnspecified,
+	"keyCompromise":        acme.CRLReasonKeyCompromise,
+	"cACompromise":         acme.CRLReasonCACompromise,
+	"affiliationChanged":   acme.CRLReasonAffiliationChanged,
+	"superseded":           acme.CRLReasonSuperseded,
+	"cessationOfOperation": acme.CRLReasonCessationOfOperation,
+	"certificateHold":      acme.CRLReasonCertificateHold,
+	"removeFromCRL":        acme.CRLReasonRemoveFromCRL,
+	"privilegeWithdrawn":   acme.CRLReasonPrivilegeWithdrawn,
+	"aACompromise":         acme.CRLReasonAACompromise,
+}
+
+func parseRevocationReason(reason string) (acme.CRLReasonCode, error) {
+	for k, v := range revocationReasons {
+		if strings.EqualFold(k, reason) {
+			return v, nil
+		}
+	}
+	if v, err := strconv.Atoi(reason); err == nil {
+		for _, r := range revocationReasons {
+			if int(r) == v {
+				return r, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("letsencrypt: invalid revocation reason: %s", reason)
+}
+
+func (l *LetsEncrypt) getVariantCertFilenames(commonName string) []string {
+	// the certificate settings are not available here, so look for the
+	// symlinks of any variant that could have been requested.
+	names := []string{""}
+	for _, kt := range keyTypes {
+		found := false
+		for _, n := range names {
+			if n == kt.GetFamily() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, kt.GetFamily())
+		}
+	}
+
+	rv := []string{}
+	for _, name := range names {
+		v := &certificateVariant{name: name}
+		certfile := l.getCertFilename(commonName, v.getName("fullchain"))
+		if _, err := os.Stat(certfile); err == nil {
+			rv = append(rv, certfile)
+		}
+	}
+	return rv
+}
+
+func (l *LetsEncrypt) RevokeCertificate(ctx context.Context, target string, reason string, useCertKey bool, keyfile string) error {
+	if l.client == nil {
+		return errors.New("letsencrypt: acme client not defined")
+	}
+
+	r, err := parseRevocationReason(reason)
+	if err != nil {
+		return err
+	}
+
+	if st, err := os.Stat(target); err == nil && !st.IsDir() {
+		return l.revokeCertificate(ctx, target, r, useCertKey, keyfile)
+	}
+
+	// all the variants of a common name are revoked, e.g. rsa and ecdsa
+	certfiles := l.getVariantCertFilenames(target)
+	if len(certfiles) == 0 {
+		return fmt.Errorf("letsencrypt: no certificate found: %s", target)
+	}
+	if len(certfiles) > 1 && keyfile != "" {
+		return fmt.Errorf("letsencrypt: %d certificates found for %s, private key can't be provided, please revoke each certificate file", len(certfiles), target)
+	}
+
+	revoked := 0
+	for _, certfile := range certfiles {
+		if isCertificateRevoked(certfile) {
+			log.Printf("certificate already revoked, skipping: %s", certfile)
+			continue
+		}
+		if err := l.revokeCertificate(ctx, certfile, r, useCertKey, keyfile); err != nil {
+			return err
+		}
+		revoked++
+	}
+	if revoked == 0 {
+		return fmt.Errorf("letsencrypt: certificates already revoked: %s", target)
+	}
+	return nil
+}
+
+func (l *LetsEncrypt) revokeCertificate(ctx context.Context, certfile string, r acme.CRLReasonCode, useCertKey bool, keyfile string) error {
+	certfile, err := filepath.EvalSymlinks(certfile)
+	if err != nil {
+		return err
+	}
+
+	if isCertificateRevoked(certfile) {
+		return fmt.Errorf("letsencrypt: certificate already revoked: %s", certfile)
+	}
+
+	chain, err := loadCertificateChain(certfile)
+	if err != nil {
+		return err
+	}
+
+	var key crypto.Signer
+	if useCertKey || keyfile != "" {
+		if keyfile == "" {
+			dir, base := filepath.Split(certfile)
+			if !strings.HasPrefix(base, "fullchain") {
+				return fmt.Errorf("letsencrypt: could not guess private key for certificate, please provide it: %s", certfile)
+			}
+			keyfile = filepath.Join(dir, "privkey"+strings.TrimPrefix(base, "fullchain"))
+		}
+
+		log.Printf("loading certificate private key: %s", keyfile)
+		key, err = loadPrivateKey(keyfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("revoking certificate (reason: %d): %s", r, certfile)
+	if err := l.client.RevokeCert(ctx, key, chain[0], r); err != nil {
+		return err
+	}
+
+	return writeFile(getRevokedFilename(certfile), []byte(fmt.Sprintf("%d %d\n", time.Now().Unix(), r)), true)
+}
@@ -0,0 +1,357 @@
+package letsencrypt
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type certificateFile struct {
+	name string
+	ext  string
+}
+
+var certificateFiles = []*certificateFile{
+	{"privkey", ".pem"},
+	{"cert", ".pem"},
+	{"chain", ".pem"},
+	{"fullchain", ".pem"},
+	{"combined", ".pem"},
+}
+
+var (
+	filePrivkey   = certificateFiles[0]
+	fileFullchain = certificateFiles[3]
+)
+
+const timestampLayout = "20060102150405"
+
+func isTimestamp(ts string) bool {
+	if len(ts) != len(timestampLayout) {
+		return false
+	}
+	for _, c := range ts {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// each version is stored in its own directory, and the stable file names are
+// symlinks to the "current" symlink, that points to a version directory. this
+// way all the files are switched at once, with a single rename(2).
+
+func (l *LetsEncrypt) getVersionDirname(ts string) string {
+	return l.getFilename(ts, "")
+}
+
+func (l *LetsEncrypt) getVersionFromDirname(name string) string {
+	if !strings.HasSuffix(name, l.suffix) {
+		return ""
+	}
+	ts := strings.TrimSuffix(name, l.suffix)
+	if !isTimestamp(ts) {
+		return ""
+	}
+	return ts
+}
+
+func (l *LetsEncrypt) getVersionFilename(commonName string, variant *certificateVariant, file *certificateFile, ts string) string {
+	return filepath.Join(l.dir, "certs", commonName, l.getVersionDirname(ts), variant.getName(file.name)+file.ext)
+}
+
+func (l *LetsEncrypt) getCurrentSymlinkFilename(commonName string, variant *certificateVariant) string {
+	return filepath.Join(l.dir, "certs", commonName, l.getFilename(variant.getName("current"), ""))
+}
+
+func (l *LetsEncrypt) getSymlinkFilename(commonName string, variant *certificateVariant, file *certificateFile) string {
+	return filepath.Join(l.dir, "certs", commonName, l.getFilename(variant.getName(file.name), file.ext))
+}
+
+func (l *LetsEncrypt) getSymlinkTarget(variant *certificateVariant, file *certificateFile) string {
+	return filepath.Join(l.getFilename(variant.getName("current"), ""), variant.getName(file.name)+file.ext)
+}
+
+// versions created by older releases are stored as timestamped files, e.g.
+// fullchain-20060102150405.pem, next to the symlinks.
+func (l *LetsEncrypt) getLegacyVersionFilename(commonName string, variant *certificateVariant, file *certificateFile, ts string) string {
+	return filepath.Join(l.dir, "certs", commonName, l.getFilename(variant.getName(file.name)+"-"+ts, file.ext))
+}
+
+func (l *LetsEncrypt) getLegacyVersionFromFilename(variant *certificateVariant, file *certificateFile, fname string) string {
+	prefix := variant.getName(file.name) + "-"
+	suffix := l.getFilename("", file.ext)
+	if !strings.HasPrefix(fname, prefix) || !strings.HasSuffix(fname, suffix) {
+		return ""
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(fname, prefix), suffix)
+	if !isTimestamp(ts) {
+		return ""
+	}
+	return ts
+}
+
+func (l *LetsEncrypt) getCurrentVersion(commonName string, variant *certificateVariant) (string, error) {
+	target, err := os.Readlink(l.getCurrentSymlinkFilename(commonName, variant))
+	if err != nil {
+		return "", err
+	}
+	ts := l.getVersionFromDirname(target)
+	if ts == "" {
+		return "", fmt.Errorf("letsencrypt: invalid symlink target: %s", target)
+	}
+
+	for _, file := range variant.files {
+		fpath := l.getSymlinkFilename(commonName, variant, file)
+		target, err := os.Readlink(fpath)
+		if err != nil {
+			return "", err
+		}
+		if target != l.getSymlinkTarget(variant, file) {
+			return "", fmt.Errorf("letsencrypt: symlink does not point to current version: %s", fpath)
+		}
+	}
+	return ts, nil
+}
+
+// getVersionFiles returns the files of a variant for a version, including
+// files from export formats that were disabled and revocation markers.
+func (l *LetsEncrypt) getVersionFiles(commonName string, variant *certificateVariant, ts string) ([]string, error) {
+	rv := []string{}
+
+	dir := filepath.Join(l.dir, "certs", commonName, l.getVersionDirname(ts))
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, st := range files {
+		for _, file := range allCertificateFiles() {
+			if strings.HasPrefix(st.Name(), variant.getName(file.name)+".") {
+				rv = append(rv, filepath.Join(dir, st.Name()))
+				break
+			}
+		}
+	}
+
+	dir = filepath.Join(l.dir, "certs", commonName)
+	files, err = ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, st := range files {
+		for _, file := range allCertificateFiles() {
+			if strings.HasPrefix(st.Name(), variant.getName(file.name)+"-"+ts+l.suffix+".") {
+				rv = append(rv, filepath.Join(dir, st.Name()))
+				break
+			}
+		}
+	}
+
+	return rv, nil
+}
+
+func (l *LetsEncrypt) hasCertificate(commonName string, variant *certificateVariant, ts string) bool {
+	if _, err := os.Stat(l.getVersionFilename(commonName, variant, fileFullchain, ts)); err == nil {
+		return true
+	}
+	_, err := os.Stat(l.getLegacyVersionFilename(commonName, variant, fileFullchain, ts))
+	return err == nil
+}
+
+// getVersions returns all the versions with any file, including versions
+// without certificate, left behind by failed issuances.
+func (l *LetsEncrypt) getVersions(commonName string, variant *certificateVariant) ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(l.dir, "certs", commonName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, st := range files {
+		if st.IsDir() {
+			if ts := l.getVersionFromDirname(st.Name()); ts != "" {
+				// version directories are shared by all variants
+				vfiles, err := l.getVersionFiles(commonName, variant, ts)
+				if err != nil {
+					return nil, err
+				}
+				if len(vfiles) > 0 {
+					found[ts] = true
+				}
+			}
+			continue
+		}
+		for _, file := range allCertificateFiles() {
+			if ts := l.getLegacyVersionFromFilename(variant, file, st.Name()); ts != "" {
+				found[ts] = true
+				break
+			}
+		}
+	}
+
+	rv := []string{}
+	for ts := range found {
+		rv = append(rv, ts)
+	}
+
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(rv)))
+	return rv, nil
+}
+
+// migrateLegacyVersion links the private key and the full chain of a version
+// created by older releases to its version directory.
+func (l *LetsEncrypt) migrateLegacyVersion(commonName string, variant *certificateVariant, ts string) error {
+	for _, file := range []*certificateFile{filePrivkey, fileFullchain} {
+		fpath := l.getVersionFilename(commonName, variant, file, ts)
+		if _, err := os.Stat(fpath); err == nil {
+			continue
+		}
+
+		legacy := l.getLegacyVersionFilename(commonName, variant, file, ts)
+		if _, err := os.Stat(legacy); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(fpath), 0700); err != nil {
+			return err
+		}
+		if err := os.Link(legacy, fpath); err != nil {
+			return err
+		}
+		if err := syncDir(filepath.Dir(fpath)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeVersion writes the files derived from the private key and the full
+// chain of a version, if missing. versions created by older releases only
+// include these 2 files.
+func (l *LetsEncrypt) completeVersion(commonName string, variant *certificateVariant, ts string) error {
+	key, err := readPrivateKey(l.getVersionFilename(commonName, variant, filePrivkey, ts))
+	if err != nil {
+		return err
+	}
+	chain, err := loadCertificateChain(l.getVersionFilename(commonName, variant, fileFullchain, ts))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range variant.files {
+		fpath := l.getVersionFilename(commonName, variant, file, ts)
+		if _, err := os.Stat(fpath); err == nil {
+			continue
+		}
+
+		var data []byte
+		switch *file {
+		case certificateFile{"cert", ".pem"}:
+			data = encodeCertificates(chain[:1])
+		case certificateFile{"chain", ".pem"}:
+			data = encodeCertificates(chain[1:])
+		case certificateFile{"combined", ".pem"}:
+			data = append(pem.EncodeToMemory(key), encodeCertificates(chain)...)
+		default:
+			data, err = l.encodeExport(variant, file, key, chain)
+			if err != nil {
+				return err
+			}
+			if data == nil {
+				continue
+			}
+		}
+
+		if err := writeFile(fpath, data, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LetsEncrypt) isVersionValid(commonName string, variant *certificateVariant, ts string) bool {
+	for _, file := range variant.files {
+		if _, err := os.Stat(l.getVersionFilename(commonName, variant, file, ts)); err != nil {
+			return false
+		}
+	}
+
+	pk, err := loadPrivateKey(l.getVersionFilename(commonName, variant, filePrivkey, ts))
+	if err != nil {
+		return false
+	}
+	chain, err := loadCertificateChain(l.getVersionFilename(commonName, variant, fileFullchain, ts))
+	if err != nil {
+		return false
+	}
+	return certificateMatchesKey(chain, pk.Public())
+}
+
+func (l *LetsEncrypt) updateSymlinks(commonName string, variant *certificateVariant, ts string) error {
+	if !l.isVersionValid(commonName, variant, ts) {
+		return fmt.Errorf("letsencrypt: [%s] refusing to switch to invalid or incomplete version: %s", commonName, ts)
+	}
+
+	if err := symlink(l.getVersionDirname(ts), l.getCurrentSymlinkFilename(commonName, variant)); err != nil {
+		return err
+	}
+
+	// the stable symlinks only change when files are added, or when
+	// migrating from older releases, and always point to the same version.
+	for _, file := range variant.files {
+		fpath := l.getSymlinkFilename(commonName, variant, file)
+		target := l.getSymlinkTarget(variant, file)
+		if t, err := os.Readlink(fpath); err == nil && t == target {
+			continue
+		}
+		if err := symlink(target, fpath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LetsEncrypt) repairSymlinks(commonName string, variant *certificateVariant) error {
+	if _, err := l.getCurrentVersion(commonName, variant); err == nil {
+		return nil
+	}
+
+	versions, err := l.getVersions(commonName, variant)
+	if err != nil {
+		return err
+	}
+
+	// prefer the version in use, then the newest
+	if target, err := os.Readlink(l.getCurrentSymlinkFilename(commonName, variant)); err == nil {
+		if ts := l.getVersionFromDirname(target); ts != "" {
+			versions = append([]string{ts}, versions...)
+		}
+	} else if target, err := os.Readlink(l.getSymlinkFilename(commonName, variant, fileFullchain)); err == nil {
+		if ts := l.getLegacyVersionFromFilename(variant, fileFullchain, target); ts != "" {
+			versions = append([]string{ts}, versions...)
+		}
+	}
+
+	for _, ts := range versions {
+		if err := l.migrateLegacyVersion(commonName, variant, ts); err != nil {
+			continue
+		}
+		if err := l.completeVersion(commonName, variant, ts); err != nil {
+			continue
+		}
+		if l.isVersionValid(commonName, variant, ts) {
+			log.Printf("[%s] symlinks inconsistent, incomplete or from older release, restoring version %s ...", commonName, ts)
+			return l.updateSymlinks(commonName, variant, ts)
+		}
+	}
+	return nil
+}
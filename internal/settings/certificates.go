@@ -6,10 +6,149 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/rafaelmartins/ledns/internal/dns"
+	"github.com/rafaelmartins/ledns/internal/letsencrypt"
 )
 
-func getCertificates(configdir string) ([][]string, error) {
+func setCertificateOption(cert *letsencrypt.Certificate, providers map[string]dns.DNS, key string, value string) error {
+	switch key {
+	case "key-type":
+		kt, err := letsencrypt.ParseKeyType(value)
+		if err != nil {
+			return err
+		}
+		cert.KeyType = kt
+
+	case "dual-key-type":
+		kt, err := letsencrypt.ParseKeyType(value)
+		if err != nil {
+			return err
+		}
+		cert.DualKeyType = kt
+
+	case "reuse-key":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		cert.ReuseKey = v
+
+	case "keep-versions":
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		cert.KeepVersions = int(v)
+
+	case "keep-days":
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		cert.KeepDays = int(v)
+
+	case "renew-before-days":
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		if v == 0 {
+			return fmt.Errorf("renew-before-days must be greater than 0")
+		}
+		cert.RenewBefore = time.Duration(v) * 24 * time.Hour
+
+	case "update-command":
+		cmd, err := shlex.Split(value)
+		if err != nil {
+			return err
+		}
+		cert.UpdateCommand = cmd
+
+	case "dns":
+		// provider names are case insensitive, like LEDNS_DNS_DEFAULT
+		p, found := providers[strings.ToLower(value)]
+		if !found {
+			return fmt.Errorf("dns provider not configured: %s", value)
+		}
+		cert.DNS = p
+
+	case "export":
+		for _, f := range strings.Split(value, ",") {
+			if f = strings.TrimSpace(f); f == "" {
+				continue
+			}
+			format, err := letsencrypt.ParseExportFormat(f)
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, e := range cert.Export {
+				if e == format {
+					found = true
+					break
+				}
+			}
+			if !found {
+				cert.Export = append(cert.Export, format)
+			}
+		}
+
+	case "export-password-env":
+		cert.ExportPasswordEnv = value
+
+	case "export-password-file":
+		cert.ExportPasswordFile = value
+
+	case "deploy":
+		d, err := letsencrypt.ParseDeploy(value)
+		if err != nil {
+			return err
+		}
+		cert.Deploy = append(cert.Deploy, d)
+
+	default:
+		return fmt.Errorf("invalid certificate option: %s", key)
+	}
+	return nil
+}
+
+func newCertificate(defaults *letsencrypt.Certificate) *letsencrypt.Certificate {
+	return &letsencrypt.Certificate{
+		KeyType:      defaults.KeyType,
+		KeepVersions: defaults.KeepVersions,
+		KeepDays:     defaults.KeepDays,
+		RenewBefore:  defaults.RenewBefore,
+	}
+}
+
+func validateCertificate(cert *letsencrypt.Certificate, certs []*letsencrypt.Certificate) error {
+	if cert.DualKeyType != "" && cert.DualKeyType.GetFamily() == cert.KeyType.GetFamily() {
+		return fmt.Errorf("dual key type must be of a different family than key type: %s", cert.DualKeyType)
+	}
+	if strings.HasPrefix(cert.Names[0], "*.") {
+		return fmt.Errorf("common name (first name in a certificate) must not be wildcard: %s", cert.Names[0])
+	}
+	for _, c := range certs {
+		if c != cert && c.Names[0] == cert.Names[0] {
+			return fmt.Errorf("common name found in 2 or more certificates: %s", cert.Names[0])
+		}
+	}
+	return nil
+}
+
+// each line defines a certificate: names separated by whitespace, optionally
+// mixed with inline key=value options. indented "key = value" lines below it
+// set more options for the same certificate, allowing values with spaces:
+//
+//	example.com www.example.com key-type=rsa2048
+//	    update-command = systemctl reload nginx
+//	    deploy = /etc/nginx/ssl
+func getCertificates(configdir string, defaults *letsencrypt.Certificate, providers map[string]dns.DNS) ([]*letsencrypt.Certificate, error) {
 	files, err := ioutil.ReadDir(configdir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -18,42 +157,88 @@ func getCertificates(configdir string) ([][]string, error) {
 		return nil, err
 	}
 
-	rv := [][]string{}
+	rv := []*letsencrypt.Certificate{}
 	for _, st := range files {
 		if st.IsDir() || strings.HasPrefix(st.Name(), ".") {
 			continue
 		}
 
-		fp, err := os.Open(filepath.Join(configdir, st.Name()))
+		fpath := filepath.Join(configdir, st.Name())
+		fp, err := os.Open(fpath)
 		if err != nil {
 			return nil, err
 		}
 		defer fp.Close()
 
+		var (
+			cert       *letsencrypt.Certificate
+			certLineno int
+		)
+		validate := func() error {
+			if cert == nil {
+				return nil
+			}
+			if err := validateCertificate(cert, rv); err != nil {
+				return fmt.Errorf("settings: %s:%d: %w", fpath, certLineno, err)
+			}
+			return nil
+		}
+
+		lineno := 0
 		scanner := bufio.NewScanner(fp)
 		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
+			lineno++
+			raw := scanner.Text()
+			line := strings.TrimSpace(raw)
 
-			if strings.HasPrefix(line, "#") {
+			if line == "" || strings.HasPrefix(line, "#") {
 				continue
 			}
 
-			names := strings.Fields(line)
-			if len(names) != 0 {
-				if strings.HasPrefix(names[0], "*.") {
-					return nil, fmt.Errorf("settings: common name (first name in a certificate) must not be wildcard: %s", names[0])
+			// indented "key = value" lines are options of the previous
+			// certificate. other indented lines are parsed as names, as
+			// in older releases.
+			if raw[0] == ' ' || raw[0] == '\t' {
+				if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+					if key := strings.TrimSpace(kv[0]); key != "" && !strings.ContainsAny(key, " \t") {
+						if cert == nil {
+							return nil, fmt.Errorf("settings: %s:%d: option defined before certificate names: %s", fpath, lineno, key)
+						}
+						if err := setCertificateOption(cert, providers, key, strings.TrimSpace(kv[1])); err != nil {
+							return nil, fmt.Errorf("settings: %s:%d: %w", fpath, lineno, err)
+						}
+						continue
+					}
 				}
-				for _, r := range rv {
-					if r[0] == names[0] {
-						return nil, fmt.Errorf("settings: common name found in 2 or more certificates: %s", names[0])
+			}
+
+			if err := validate(); err != nil {
+				return nil, err
+			}
+
+			cert = newCertificate(defaults)
+			certLineno = lineno
+			for _, field := range strings.Fields(line) {
+				// names can't include '=', so anything with it is an option
+				if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+					if err := setCertificateOption(cert, providers, kv[0], kv[1]); err != nil {
+						return nil, fmt.Errorf("settings: %s:%d: %w", fpath, lineno, err)
 					}
+					continue
 				}
-				rv = append(rv, names)
+				cert.Names = append(cert.Names, field)
 			}
+			if len(cert.Names) == 0 {
+				return nil, fmt.Errorf("settings: %s:%d: no names defined for certificate", fpath, lineno)
+			}
+			rv = append(rv, cert)
 		}
 		if err := scanner.Err(); err != nil {
 			return nil, err
 		}
+		if err := validate(); err != nil {
+			return nil, err
+		}
 	}
 
 	return rv, nil
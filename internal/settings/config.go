@@ -0,0 +1,289 @@
+package settings
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rafaelmartins/ledns/internal/dns"
+	"github.com/rafaelmartins/ledns/internal/letsencrypt"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configFile string
+	cfg        *config
+)
+
+type configValue struct {
+	key     string
+	value   string
+	line    int
+	used    bool
+	ignored string
+}
+
+type config struct {
+	file         string
+	values       map[string]*configValue
+	certificates []*yaml.Node
+}
+
+// options that may be defined multiple times for a certificate
+var repeatableCertificateOptions = map[string]bool{
+	"deploy": true,
+	"export": true,
+}
+
+// settings that accept multiple values, separated by commas. lists are only
+// accepted for them.
+func isListSetting(name string) bool {
+	return name == "LEDNS_ACCOUNT_EMAIL" || strings.HasSuffix(name, "_ZONES")
+}
+
+func SetConfigFile(f string) {
+	configFile = f
+}
+
+// nested keys of the configuration file are mapped to the names of the
+// environment variables, e.g. "cloudns: {auth-id: foo}" is the same as
+// LEDNS_CLOUDNS_AUTH_ID=foo.
+func getEnvName(path []string) string {
+	return "LEDNS_" + strings.ToUpper(strings.ReplaceAll(strings.Join(path, "_"), "-", "_"))
+}
+
+func loadConfig(fpath string) (*config, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("settings: %s: %w", fpath, err)
+	}
+
+	rv := &config{
+		file:   fpath,
+		values: map[string]*configValue{},
+	}
+	if len(root.Content) == 0 {
+		return rv, nil
+	}
+	if err := rv.load(root.Content[0], nil); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (c *config) errorf(node *yaml.Node, format string, a ...interface{}) error {
+	return fmt.Errorf("settings: %s:%d: %s", c.file, node.Line, fmt.Sprintf(format, a...))
+}
+
+func (c *config) getScalar(node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", c.errorf(node, "expected a scalar value")
+	}
+	return node.Value, nil
+}
+
+func (c *config) getList(node *yaml.Node) ([]string, error) {
+	if node.Kind != yaml.SequenceNode {
+		v, err := c.getScalar(node)
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+
+	rv := []string{}
+	for _, n := range node.Content {
+		v, err := c.getScalar(n)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, v)
+	}
+	return rv, nil
+}
+
+func (c *config) load(node *yaml.Node, path []string) error {
+	if node.Kind != yaml.MappingNode {
+		return c.errorf(node, "expected a mapping")
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		p := append(append([]string{}, path...), k.Value)
+
+		if len(path) == 0 && k.Value == "certificates" {
+			if v.Kind != yaml.SequenceNode {
+				return c.errorf(v, "certificates: expected a list")
+			}
+			c.certificates = v.Content
+			continue
+		}
+
+		if v.Kind == yaml.MappingNode {
+			if err := c.load(v, p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := getEnvName(p)
+		if v.Kind == yaml.SequenceNode && !isListSetting(name) {
+			return c.errorf(v, "%s: setting does not accept a list", strings.Join(p, "."))
+		}
+
+		// lists are joined with commas, like multiple values in environment
+		// variables, e.g. account-email.
+		values, err := c.getList(v)
+		if err != nil {
+			return err
+		}
+
+		if prev, found := c.values[name]; found {
+			return c.errorf(k, "%s: setting already defined at line %d", strings.Join(p, "."), prev.line)
+		}
+		c.values[name] = &configValue{
+			key:   strings.Join(p, "."),
+			value: strings.Join(values, ","),
+			line:  v.Line,
+		}
+	}
+	return nil
+}
+
+func (c *config) lookup(key string) *configValue {
+	if c == nil {
+		return nil
+	}
+	v, found := c.values[key]
+	if !found {
+		return nil
+	}
+	v.used = true
+	return v
+}
+
+func (c *config) keys() []string {
+	if c == nil {
+		return nil
+	}
+
+	rv := []string{}
+	for k := range c.values {
+		rv = append(rv, k)
+	}
+	return rv
+}
+
+// ignore records why valid settings with the given prefix were not used, e.g.
+// settings of a DNS provider that is not configured, so that they are not
+// reported as unknown.
+func (c *config) ignore(prefix string, reason string) {
+	if c == nil {
+		return
+	}
+	for name, v := range c.values {
+		if strings.HasPrefix(name, prefix) && !v.used {
+			v.ignored = reason
+		}
+	}
+}
+
+func (c *config) checkUnused() error {
+	if c == nil {
+		return nil
+	}
+
+	unused := []*configValue{}
+	for _, v := range c.values {
+		if !v.used {
+			unused = append(unused, v)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].line < unused[j].line
+	})
+	if unused[0].ignored != "" {
+		return fmt.Errorf("settings: %s:%d: ignored setting: %s: %s", c.file, unused[0].line, unused[0].key, unused[0].ignored)
+	}
+	return fmt.Errorf("settings: %s:%d: unknown setting: %s", c.file, unused[0].line, unused[0].key)
+}
+
+func (c *config) getCertificates(defaults *letsencrypt.Certificate, providers map[string]dns.DNS, certs []*letsencrypt.Certificate) ([]*letsencrypt.Certificate, error) {
+	if c == nil {
+		return certs, nil
+	}
+
+	for _, node := range c.certificates {
+		if node.Kind != yaml.MappingNode {
+			return nil, c.errorf(node, "certificates: expected a mapping")
+		}
+
+		cert := newCertificate(defaults)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+
+			if k.Value == "names" {
+				names, err := c.getList(v)
+				if err != nil {
+					return nil, err
+				}
+				for _, n := range names {
+					cert.Names = append(cert.Names, strings.Fields(n)...)
+				}
+				continue
+			}
+
+			var (
+				values []string
+				err    error
+			)
+			if repeatableCertificateOptions[k.Value] {
+				values, err = c.getList(v)
+			} else {
+				var value string
+				value, err = c.getScalar(v)
+				values = []string{value}
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				if err := setCertificateOption(cert, providers, k.Value, value); err != nil {
+					return nil, c.errorf(v, "%s", err)
+				}
+			}
+		}
+
+		if len(cert.Names) == 0 {
+			return nil, c.errorf(node, "no names defined for certificate")
+		}
+		if err := validateCertificate(cert, certs); err != nil {
+			return nil, c.errorf(node, "%s", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// keyErrorf reports an error for a setting, pointing to the configuration
+// file position if the value was read from it.
+func keyErrorf(key string, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if _, found := os.LookupEnv(key); !found {
+		if v := cfg.lookup(key); v != nil {
+			return fmt.Errorf("settings: %s:%d: %s: %s", cfg.file, v.line, v.key, msg)
+		}
+	}
+	return fmt.Errorf("settings: %s: %s", key, msg)
+}
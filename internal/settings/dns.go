@@ -0,0 +1,478 @@
+package settings
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/shlex"
+	"github.com/rafaelmartins/ledns/internal/dns"
+	"github.com/rafaelmartins/ledns/internal/dns/cloudflare"
+	"github.com/rafaelmartins/ledns/internal/dns/cloudns"
+	"github.com/rafaelmartins/ledns/internal/dns/desec"
+	"github.com/rafaelmartins/ledns/internal/dns/digitalocean"
+	"github.com/rafaelmartins/ledns/internal/dns/exec"
+	"github.com/rafaelmartins/ledns/internal/dns/gandi"
+	"github.com/rafaelmartins/ledns/internal/dns/hetzner"
+	"github.com/rafaelmartins/ledns/internal/dns/linode"
+	"github.com/rafaelmartins/ledns/internal/dns/ovh"
+	"github.com/rafaelmartins/ledns/internal/dns/powerdns"
+	"github.com/rafaelmartins/ledns/internal/dns/rfc2136"
+	"github.com/rafaelmartins/ledns/internal/dns/route53"
+	"github.com/rafaelmartins/ledns/internal/dns/vultr"
+)
+
+// factories read their settings from environment variables starting with
+// the prefix of the instance, e.g. LEDNS_DNS_<NAME>_ or LEDNS_HETZNER_. the
+// returned function creates the provider, as some providers contact their
+// APIs when created, and only commands issuing certificates use them.
+type dnsProviderFactory func(prefix string) (func() (dns.DNS, error), error)
+
+var dnsProviderFactories = map[string]dnsProviderFactory{
+	"cloudflare":   newCloudflare,
+	"cloudns":      newClouDNS,
+	"desec":        newDeSEC,
+	"digitalocean": newDigitalOcean,
+	"exec":         newExec,
+	"gandi":        newGandi,
+	"hetzner":      newHetzner,
+	"linode":       newLinode,
+	"ovh":          newOVH,
+	"powerdns":     newPowerDNS,
+	"rfc2136":      newRFC2136,
+	"route53":      newRoute53,
+	"vultr":        newVultr,
+}
+
+func newCloudflare(prefix string) (func() (dns.DNS, error), error) {
+	apiToken, err := getSecret(prefix+"API_TOKEN", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return cloudflare.NewCloudflare("", apiToken)
+	}, nil
+}
+
+func newClouDNS(prefix string) (func() (dns.DNS, error), error) {
+	authID, err := getString(prefix+"AUTH_ID", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	subAuthID, err := getString(prefix+"SUB_AUTH_ID", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if authID == "" && subAuthID == "" {
+		return nil, fmt.Errorf("settings: %sAUTH_ID or %sSUB_AUTH_ID is required", prefix, prefix)
+	}
+	if authID != "" && subAuthID != "" {
+		return nil, keyErrorf(prefix+"AUTH_ID", "mutually exclusive with %sSUB_AUTH_ID", prefix)
+	}
+
+	authPassword, err := getSecret(prefix+"AUTH_PASSWORD", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return cloudns.NewClouDNS(authID, subAuthID, authPassword)
+	}, nil
+}
+
+func newDeSEC(prefix string) (func() (dns.DNS, error), error) {
+	apiToken, err := getSecret(prefix+"API_TOKEN", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return desec.NewDeSEC("", apiToken)
+	}, nil
+}
+
+func newDigitalOcean(prefix string) (func() (dns.DNS, error), error) {
+	apiToken, err := getSecret(prefix+"API_TOKEN", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return digitalocean.NewDigitalOcean("", apiToken)
+	}, nil
+}
+
+func getCommand(key string, required bool) ([]string, error) {
+	v, err := getString(key, "", required)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := shlex.Split(v)
+	if err != nil {
+		return nil, keyErrorf(key, "%s", err)
+	}
+	return rv, nil
+}
+
+func newExec(prefix string) (func() (dns.DNS, error), error) {
+	addCommand, err := getCommand(prefix+"ADD_COMMAND", true)
+	if err != nil {
+		return nil, err
+	}
+
+	checkCommand, err := getCommand(prefix+"CHECK_COMMAND", false)
+	if err != nil {
+		return nil, err
+	}
+
+	removeCommand, err := getCommand(prefix+"REMOVE_COMMAND", true)
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutSeconds, err := getUint(prefix+"TIMEOUT_SECONDS", 60, false, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return exec.NewExec(addCommand, checkCommand, removeCommand, time.Duration(timeoutSeconds)*time.Second)
+	}, nil
+}
+
+func newGandi(prefix string) (func() (dns.DNS, error), error) {
+	apiKey, err := getSecret(prefix+"API_KEY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	personalAccessToken, err := getSecret(prefix+"PERSONAL_ACCESS_TOKEN", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return gandi.NewGandi("", apiKey, personalAccessToken)
+	}, nil
+}
+
+func newHetzner(prefix string) (func() (dns.DNS, error), error) {
+	apiKey, err := getSecret(prefix+"API_KEY", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return hetzner.NewHetzner(apiKey)
+	}, nil
+}
+
+func newLinode(prefix string) (func() (dns.DNS, error), error) {
+	apiToken, err := getSecret(prefix+"API_TOKEN", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return linode.NewLinode("", apiToken)
+	}, nil
+}
+
+func newOVH(prefix string) (func() (dns.DNS, error), error) {
+	endpoint, err := getString(prefix+"ENDPOINT", "ovh-eu", true)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationKey, err := getString(prefix+"APPLICATION_KEY", "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationSecret, err := getSecret(prefix+"APPLICATION_SECRET", true)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerKey, err := getSecret(prefix+"CONSUMER_KEY", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return ovh.NewOVH(endpoint, applicationKey, applicationSecret, consumerKey)
+	}, nil
+}
+
+func newPowerDNS(prefix string) (func() (dns.DNS, error), error) {
+	apiUrl, err := getString(prefix+"API_URL", "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := getSecret(prefix+"API_KEY", true)
+	if err != nil {
+		return nil, err
+	}
+
+	serverID, err := getString(prefix+"SERVER_ID", "localhost", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return powerdns.NewPowerDNS(apiUrl, apiKey, serverID)
+	}, nil
+}
+
+func newRFC2136(prefix string) (func() (dns.DNS, error), error) {
+	server, err := getString(prefix+"SERVER", "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol, err := getString(prefix+"PROTOCOL", "udp", true)
+	if err != nil {
+		return nil, err
+	}
+
+	keyName, err := getString(prefix+"TSIG_KEY_NAME", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := getString(prefix+"TSIG_ALGORITHM", "hmac-sha256", true)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := getSecret(prefix+"TSIG_SECRET", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return rfc2136.NewRFC2136(server, protocol, keyName, algorithm, secret)
+	}, nil
+}
+
+func newRoute53(prefix string) (func() (dns.DNS, error), error) {
+	accessKeyID, err := getString(prefix+"ACCESS_KEY_ID", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	secretAccessKey, err := getSecret(prefix+"SECRET_ACCESS_KEY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionToken, err := getSecret(prefix+"SESSION_TOKEN", false)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := getString(prefix+"PROFILE", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return route53.NewRoute53("", accessKeyID, secretAccessKey, sessionToken, profile)
+	}, nil
+}
+
+func newVultr(prefix string) (func() (dns.DNS, error), error) {
+	apiKey, err := getSecret(prefix+"API_KEY", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (dns.DNS, error) {
+		return vultr.NewVultr("", apiKey)
+	}, nil
+}
+
+type dnsInstance struct {
+	name   string
+	typ    string
+	prefix string
+}
+
+func getDNSInstances() ([]*dnsInstance, error) {
+	rv := []*dnsInstance{}
+
+	// named instances: LEDNS_DNS_<NAME>_TYPE
+	keys := cfg.keys()
+	for _, env := range os.Environ() {
+		keys = append(keys, strings.SplitN(env, "=", 2)[0])
+	}
+	sort.Strings(keys)
+
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "LEDNS_DNS_") || !strings.HasSuffix(key, "_TYPE") || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "LEDNS_DNS_"), "_TYPE")
+		if name == "" {
+			continue
+		}
+		for _, r := range name {
+			if !unicode.IsUpper(r) && !unicode.IsDigit(r) && r != '_' {
+				return nil, keyErrorf(key, "invalid dns provider name")
+			}
+		}
+
+		typ, err := getString(key, "", true)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, &dnsInstance{
+			name:   strings.ToLower(name),
+			typ:    strings.ToLower(typ),
+			prefix: "LEDNS_DNS_" + name + "_",
+		})
+	}
+
+	// legacy instances, named after the provider type
+	cloudnsAuthID, err := getString("LEDNS_CLOUDNS_AUTH_ID", "", false)
+	if err != nil {
+		return nil, err
+	}
+	cloudnsSubAuthID, err := getString("LEDNS_CLOUDNS_SUB_AUTH_ID", "", false)
+	if err != nil {
+		return nil, err
+	}
+	if cloudnsAuthID != "" || cloudnsSubAuthID != "" {
+		rv = append(rv, &dnsInstance{
+			name:   "cloudns",
+			typ:    "cloudns",
+			prefix: "LEDNS_CLOUDNS_",
+		})
+	} else {
+		cfg.ignore("LEDNS_CLOUDNS_", "ClouDNS provider not configured, auth-id or sub-auth-id required")
+	}
+
+	hetznerAPIKey, err := getSecret("LEDNS_HETZNER_API_KEY", false)
+	if err != nil {
+		return nil, err
+	}
+	if hetznerAPIKey != "" {
+		rv = append(rv, &dnsInstance{
+			name:   "hetzner",
+			typ:    "hetzner",
+			prefix: "LEDNS_HETZNER_",
+		})
+	} else {
+		cfg.ignore("LEDNS_HETZNER_", "Hetzner provider not configured, api-key required")
+	}
+
+	// settings of named instances without type
+	for _, key := range cfg.keys() {
+		if !strings.HasPrefix(key, "LEDNS_DNS_") || key == "LEDNS_DNS_DEFAULT" {
+			continue
+		}
+		found := false
+		for _, inst := range rv {
+			if strings.HasPrefix(key, inst.prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cfg.ignore(key, "DNS provider type not defined")
+		}
+	}
+
+	return rv, nil
+}
+
+func getDNSProviders() (map[string]dns.DNS, map[string]dns.DNS, dns.DNS, error) {
+	instances, err := getDNSInstances()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	providers := map[string]dns.DNS{}
+	zones := map[string]dns.DNS{}
+	zoneNames := map[string]string{}
+	for _, inst := range instances {
+		if _, found := providers[inst.name]; found {
+			return nil, nil, nil, fmt.Errorf("settings: DNS provider defined more than once: %s", inst.name)
+		}
+
+		factory, found := dnsProviderFactories[inst.typ]
+		if !found {
+			return nil, nil, nil, keyErrorf(inst.prefix+"TYPE", "invalid DNS provider type: %s", inst.typ)
+		}
+
+		f, err := factory(inst.prefix)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		p := dns.NewLazy(f)
+		providers[inst.name] = p
+
+		zonesStr, err := getString(inst.prefix+"ZONES", "", false)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, zone := range strings.FieldsFunc(zonesStr, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		}) {
+			zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+			if other, found := zoneNames[zone]; found {
+				return nil, nil, nil, keyErrorf(inst.prefix+"ZONES", "zone already mapped to DNS provider %s: %s", other, zone)
+			}
+			zoneNames[zone] = inst.name
+			zones[zone] = p
+		}
+	}
+
+	def, err := getString("LEDNS_DNS_DEFAULT", "", false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	hasZones := map[string]bool{}
+	for _, name := range zoneNames {
+		hasZones[name] = true
+	}
+
+	var fallback dns.DNS
+	if def != "" {
+		p, found := providers[strings.ToLower(def)]
+		if !found {
+			return nil, nil, nil, keyErrorf("LEDNS_DNS_DEFAULT", "DNS provider not defined: %s", def)
+		}
+		fallback = p
+	} else if providers["cloudns"] != nil && providers["hetzner"] != nil && (!hasZones["cloudns"] || !hasZones["hetzner"]) {
+		// hetzner used to silently override cloudns, if both were configured
+		return nil, nil, nil, fmt.Errorf("settings: both ClouDNS and Hetzner DNS providers configured, please export LEDNS_DNS_DEFAULT or map zones with LEDNS_CLOUDNS_ZONES and LEDNS_HETZNER_ZONES")
+	} else if len(providers) == 1 {
+		for _, p := range providers {
+			fallback = p
+		}
+	} else if len(providers) > 1 {
+		log.Print("WARNING: no default DNS provider defined. please export LEDNS_DNS_DEFAULT if any zone is not mapped to a DNS provider.")
+	}
+
+	// certificates may select a provider, but mapped zones always use
+	// their own providers.
+	certProviders := map[string]dns.DNS{}
+	for name, p := range providers {
+		certProviders[name] = dns.NewMux(zones, p)
+	}
+
+	return providers, certProviders, dns.NewMux(zones, fallback), nil
+}
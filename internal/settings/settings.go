@@ -1,17 +1,20 @@
 package settings
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/shlex"
 	"github.com/rafaelmartins/ledns/internal/dns"
-	"github.com/rafaelmartins/ledns/internal/dns/cloudns"
-	"github.com/rafaelmartins/ledns/internal/dns/hetzner"
+	"github.com/rafaelmartins/ledns/internal/letsencrypt"
 )
 
 var (
@@ -19,33 +22,115 @@ var (
 )
 
 type Settings struct {
-	ClouDNSAuthID       string
-	ClouDNSSubAuthID    string
-	ClouDNSAuthPassword string
-	HetznerAPIKey       string
-	DataDir             string
-	Certificates        [][]string
-	UpdateCommand       []string
-	UpdateCommandOnce   []string
-	Production          bool
-	Force               bool
-	Timeout             time.Duration
-	DNSProvider         dns.DNS
+	DataDir           string
+	Certificates      []*letsencrypt.Certificate
+	KeyType           letsencrypt.KeyType
+	KeepVersions      int
+	KeepDays          int
+	RenewBefore       time.Duration
+	UpdateCommand     []string
+	UpdateCommandOnce []string
+	Production        bool
+	ACMEDirectory     string
+	ACMEEABKeyID      string
+	AccountEmails     []string
+	ACMEEABHMACKey    []byte
+	Force             bool
+	Timeout           time.Duration
+	DNSProvider       dns.DNS
+	DNSProviders      map[string]dns.DNS
 }
 
 func getString(key string, def string, required bool) (string, error) {
+	// always looked up, to mark the file value as used when overridden
+	cv := cfg.lookup(key)
+
 	if v, found := os.LookupEnv(key); found {
 		if required && v == "" {
 			return "", fmt.Errorf("settings: %s empty", key)
 		}
 		return v, nil
 	}
+	if cv != nil {
+		if required && cv.value == "" {
+			return "", keyErrorf(key, "empty")
+		}
+		return cv.value, nil
+	}
 	if required && def == "" {
 		return "", fmt.Errorf("settings: %s missing", key)
 	}
 	return def, nil
 }
 
+func readSecretFile(key string, fpath string) (string, error) {
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return "", keyErrorf(key, "%s", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// secrets may also be read from the file set in <KEY>_FILE, or from a
+// systemd credential named <KEY>. environment variables take precedence
+// over the configuration file, as for other settings.
+func getSecret(key string, required bool) (string, error) {
+	fileKey := key + "_FILE"
+	cv := cfg.lookup(key)
+	cfv := cfg.lookup(fileKey)
+
+	v, found := os.LookupEnv(key)
+	f, fileFound := os.LookupEnv(fileKey)
+	if found && fileFound {
+		return "", fmt.Errorf("settings: %s and %s are mutually exclusive", key, fileKey)
+	}
+	if !found && !fileFound {
+		if cv != nil && cfv != nil {
+			return "", keyErrorf(fileKey, "mutually exclusive with %s", cv.key)
+		}
+		if cv != nil {
+			v, found = cv.value, true
+		} else if cfv != nil {
+			f, fileFound = cfv.value, true
+		}
+	}
+
+	if fileFound {
+		if f == "" {
+			return "", keyErrorf(fileKey, "empty")
+		}
+		v, err := readSecretFile(fileKey, f)
+		if err != nil {
+			return "", err
+		}
+		if required && v == "" {
+			return "", keyErrorf(fileKey, "file is empty: %s", f)
+		}
+		return v, nil
+	}
+
+	if !found {
+		if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+			cred := filepath.Join(dir, key)
+			if _, err := os.Stat(cred); err == nil {
+				c, err := readSecretFile(key, cred)
+				if err != nil {
+					return "", err
+				}
+				v, found = c, true
+			}
+		}
+	}
+
+	if required && v == "" {
+		if found {
+			return "", keyErrorf(key, "empty")
+		}
+		return "", fmt.Errorf("settings: %s missing", key)
+	}
+	return v, nil
+}
+
 func getUint(key string, def uint64, required bool, base int, bitSize int) (uint64, error) {
 	v, err := getString(key, strconv.FormatUint(def, base), required)
 	if err != nil {
@@ -53,10 +138,10 @@ func getUint(key string, def uint64, required bool, base int, bitSize int) (uint
 	}
 	v2, err := strconv.ParseUint(v, base, bitSize)
 	if err != nil {
-		return 0, err
+		return 0, keyErrorf(key, "%s", err)
 	}
 	if required && v2 == 0 {
-		return 0, fmt.Errorf("settings: %s empty", key)
+		return 0, keyErrorf(key, "empty")
 	}
 	return v2, nil
 }
@@ -68,7 +153,7 @@ func getBool(key string, def bool) (bool, error) {
 	}
 	v2, err := strconv.ParseBool(v)
 	if err != nil {
-		return false, err
+		return false, keyErrorf(key, "%s", err)
 	}
 	return v2, nil
 }
@@ -81,70 +166,82 @@ func Get() (*Settings, error) {
 	var err error
 	s := &Settings{}
 
-	s.ClouDNSAuthID, err = getString("LEDNS_CLOUDNS_AUTH_ID", "", false)
+	if configFile == "" {
+		configFile = os.Getenv("LEDNS_CONFIG_FILE")
+	}
+	if configFile != "" {
+		cfg, err = loadConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var certProviders map[string]dns.DNS
+	s.DNSProviders, certProviders, s.DNSProvider, err = getDNSProviders()
 	if err != nil {
 		return nil, err
 	}
 
-	s.ClouDNSSubAuthID, err = getString("LEDNS_CLOUDNS_SUB_AUTH_ID", "", false)
+	s.DataDir, err = getString("LEDNS_DATA_DIR", "/var/lib/ledns", true)
 	if err != nil {
 		return nil, err
 	}
-
-	s.ClouDNSAuthPassword, err = getString("LEDNS_CLOUDNS_AUTH_PASSWORD", "", false)
+	s.DataDir, err = filepath.Abs(s.DataDir)
 	if err != nil {
 		return nil, err
 	}
 
-	if s.ClouDNSAuthID != "" || s.ClouDNSSubAuthID != "" {
-		if s.ClouDNSAuthID != "" && s.ClouDNSSubAuthID != "" {
-			return nil, fmt.Errorf("settings: LEDNS_CLOUDNS_AUTH_ID and LEDNS_CLOUDNS_SUB_AUTH_ID are mutually exclusive")
-		}
-		if s.ClouDNSAuthPassword == "" {
-			return nil, fmt.Errorf("settings: LEDNS_CLOUDNS_AUTH_PASSWORD is required")
-		}
-		if p, err := cloudns.NewClouDNS(s.ClouDNSAuthID, s.ClouDNSSubAuthID, s.ClouDNSAuthPassword); err != nil {
-			return nil, err
-		} else {
-			s.DNSProvider = p
-		}
+	configDir, err := getString("LEDNS_CONFIG_DIR", "/etc/ledns.d", true)
+	if err != nil {
+		return nil, err
 	}
-
-	s.HetznerAPIKey, err = getString("LEDNS_HETZNER_API_KEY", "", false)
+	configDir, err = filepath.Abs(configDir)
 	if err != nil {
 		return nil, err
 	}
 
-	if s.HetznerAPIKey != "" {
-		if p, err := hetzner.NewHetzner(s.HetznerAPIKey); err != nil {
-			return nil, err
-		} else {
-			s.DNSProvider = p
-		}
+	keyType, err := getString("LEDNS_KEY_TYPE", string(letsencrypt.KeyTypeDefault), true)
+	if err != nil {
+		return nil, err
 	}
-
-	if s.DNSProvider == nil {
-		return nil, fmt.Errorf("settings: DNS provider configuration missing")
+	s.KeyType, err = letsencrypt.ParseKeyType(keyType)
+	if err != nil {
+		return nil, keyErrorf("LEDNS_KEY_TYPE", "%s", err)
 	}
 
-	s.DataDir, err = getString("LEDNS_DATA_DIR", "/var/lib/ledns", true)
+	keepVersions, err := getUint("LEDNS_KEEP_VERSIONS", 0, false, 10, 16)
 	if err != nil {
 		return nil, err
 	}
-	s.DataDir, err = filepath.Abs(s.DataDir)
+	s.KeepVersions = int(keepVersions)
+
+	keepDays, err := getUint("LEDNS_KEEP_DAYS", 0, false, 10, 16)
 	if err != nil {
 		return nil, err
 	}
+	s.KeepDays = int(keepDays)
 
-	configDir, err := getString("LEDNS_CONFIG_DIR", "/etc/ledns.d", true)
+	renewBeforeDays, err := getUint("LEDNS_RENEW_BEFORE_DAYS", 30, true, 10, 16)
 	if err != nil {
 		return nil, err
 	}
-	configDir, err = filepath.Abs(configDir)
+	s.RenewBefore = time.Duration(renewBeforeDays) * 24 * time.Hour
+
+	s.Certificates, err = getCertificates(configDir, &letsencrypt.Certificate{
+		KeyType:      s.KeyType,
+		KeepVersions: s.KeepVersions,
+		KeepDays:     s.KeepDays,
+		RenewBefore:  s.RenewBefore,
+	}, certProviders)
 	if err != nil {
 		return nil, err
 	}
-	s.Certificates, err = getCertificates(configDir)
+	s.Certificates, err = cfg.getCertificates(&letsencrypt.Certificate{
+		KeyType:      s.KeyType,
+		KeepVersions: s.KeepVersions,
+		KeepDays:     s.KeepDays,
+		RenewBefore:  s.RenewBefore,
+	}, certProviders, s.Certificates)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +252,7 @@ func Get() (*Settings, error) {
 	}
 	s.UpdateCommandOnce, err = shlex.Split(updateCommandOnce)
 	if err != nil {
-		return nil, err
+		return nil, keyErrorf("LEDNS_UPDATE_COMMAND_ONCE", "%s", err)
 	}
 
 	updateCommand, err := getString("LEDNS_UPDATE_COMMAND", "", false)
@@ -164,15 +261,58 @@ func Get() (*Settings, error) {
 	}
 	s.UpdateCommand, err = shlex.Split(updateCommand)
 	if err != nil {
-		return nil, err
+		return nil, keyErrorf("LEDNS_UPDATE_COMMAND", "%s", err)
 	}
 
 	s.Production, err = getBool("LEDNS_PRODUCTION", false)
 	if err != nil {
 		return nil, err
 	}
-	if !s.Production {
-		log.Print("WARNING: using staging endpoint for Let's Encrypt. please export LEDNS_PRODUCTION=true to use production endpoint when ready for it.")
+
+	s.ACMEDirectory, err = getString("LEDNS_ACME_DIRECTORY", "", false)
+	if err != nil {
+		return nil, err
+	}
+	if s.ACMEDirectory == "" {
+		if s.Production {
+			s.ACMEDirectory = letsencrypt.DirectoryProduction
+		} else {
+			s.ACMEDirectory = letsencrypt.DirectoryStaging
+			log.Print("WARNING: using staging endpoint for Let's Encrypt. please export LEDNS_PRODUCTION=true to use production endpoint when ready for it.")
+		}
+	}
+
+	accountEmails, err := getString("LEDNS_ACCOUNT_EMAIL", "", false)
+	if err != nil {
+		return nil, err
+	}
+	s.AccountEmails = strings.FieldsFunc(accountEmails, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, email := range s.AccountEmails {
+		if !strings.Contains(email, "@") {
+			return nil, keyErrorf("LEDNS_ACCOUNT_EMAIL", "invalid email: %s", email)
+		}
+	}
+
+	s.ACMEEABKeyID, err = getString("LEDNS_ACME_EAB_KID", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	eabHMACKey, err := getSecret("LEDNS_ACME_EAB_HMAC_KEY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.ACMEEABKeyID != "" || eabHMACKey != "" {
+		if s.ACMEEABKeyID == "" || eabHMACKey == "" {
+			return nil, fmt.Errorf("settings: LEDNS_ACME_EAB_KID and LEDNS_ACME_EAB_HMAC_KEY must be defined together")
+		}
+		s.ACMEEABHMACKey, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(eabHMACKey, "="))
+		if err != nil {
+			return nil, keyErrorf("LEDNS_ACME_EAB_HMAC_KEY", "not valid base64url: %s", err)
+		}
 	}
 
 	s.Force, err = getBool("LEDNS_FORCE", false)
@@ -186,6 +326,10 @@ func Get() (*Settings, error) {
 	}
 	s.Timeout = time.Duration(timeoutMinutes) * time.Minute
 
+	if err := cfg.checkUnused(); err != nil {
+		return nil, err
+	}
+
 	settings = s
 
 	return s, nil
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"syscall"
 
 	"github.com/rafaelmartins/ledns/internal/letsencrypt"
@@ -13,29 +17,72 @@ import (
 	"github.com/rafaelmartins/ledns/internal/settings"
 )
 
+var configFile string
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-config FILE] [command] [args]\n\noptions:\n", filepath.Base(os.Args[0]))
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), "\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "    %-24s %s\n", cmd.name, cmd.help)
+	}
+}
+
 func main() {
 	log.SetPrefix("ledns: ")
 	log.SetFlags(0)
 
+	flag.StringVar(&configFile, "config", "", "configuration file (overrides LEDNS_CONFIG_FILE)")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmdName := defaultCommand
+	args := []string{}
+	if flag.NArg() > 0 {
+		cmdName = flag.Arg(0)
+		args = flag.Args()[1:]
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == cmdName {
+			cmd = c
+			break
+		}
+	}
+	if cmd == nil {
+		log.Printf("error: invalid command: %s", cmdName)
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Parse(args)
+
+	settings.SetConfigFile(configFile)
 	s, err := settings.Get()
 	if err != nil {
 		log.Fatal("error: ", err)
 	}
 
-	log.Printf("starting ...")
+	log.Printf("starting %s ...", cmd.name)
 	log.Printf("    timeout: %s", s.Timeout)
+	log.Printf("    acme directory: %s", s.ACMEDirectory)
 	log.Printf("    data directory: %s", s.DataDir)
-	log.Printf("    certificates:")
-	if len(s.Certificates) > 0 {
-		for _, cert := range s.Certificates {
-			log.Printf("        %q", cert)
-		}
-	} else {
-		log.Printf("        no certificates defined. exiting ...")
-		return
+	if len(s.AccountEmails) > 0 {
+		log.Printf("    account emails: %q", s.AccountEmails)
+	}
+	providers := []string{}
+	for name := range s.DNSProviders {
+		providers = append(providers, name)
 	}
+	sort.Strings(providers)
+	log.Printf("    dns providers: %q", providers)
 
-	sigInt := make(chan os.Signal)
+	sigInt := make(chan os.Signal, 1)
 	signal.Notify(sigInt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
 	go func() {
@@ -55,45 +102,28 @@ func main() {
 		log.Fatal("error: ", e)
 	}
 
-	le, err := letsencrypt.NewLetsEncrypt(ctx, s.DataDir, s.Production, s.DNSProvider)
+	account := &letsencrypt.Account{
+		Emails:     s.AccountEmails,
+		EABKeyID:   s.ACMEEABKeyID,
+		EABHMACKey: s.ACMEEABHMACKey,
+	}
+
+	le, err := letsencrypt.NewLetsEncrypt(s.DataDir, s.ACMEDirectory, account, s.DNSProvider)
 	if err != nil {
 		exit(err)
 	}
 
-	badCerts := [][]string{}
-	newCerts := [][]string{}
-	for _, cert := range s.Certificates {
-		if len(cert) == 0 {
-			continue
-		}
-
-		newCert, err := le.GetCertificate(ctx, cert, s.Force)
-		if err != nil {
-			log.Print("error: ", err)
-			badCerts = append(badCerts, cert)
-			continue
-		}
-		if newCert {
-			newCerts = append(newCerts, cert)
-		}
+	if cmd.needsDNS && len(s.DNSProviders) == 0 {
+		exit(errors.New("DNS provider configuration missing"))
 	}
 
-	if len(s.UpdateCommandOnce) > 0 {
-		if len(newCerts) > 0 {
-			if err := le.RunCommandOnce(s.UpdateCommandOnce); err != nil {
-				exit(err)
-			}
-		}
-	} else {
-		for _, cert := range newCerts {
-			if err := le.RunCommand(cert, s.UpdateCommand); err != nil {
-				exit(err)
-			}
+	if cmd.needsClient {
+		if err := le.InitClient(ctx); err != nil {
+			exit(err)
 		}
 	}
 
-	if len(badCerts) > 0 {
-		l.Close()
-		log.Fatalf("error: failed to get certificate(s): %q", badCerts)
+	if err := cmd.run(ctx, s, le, fs.Args()); err != nil {
+		exit(err)
 	}
 }